@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/credentials"
+)
+
+func cmdConfig(args []string) {
+	if len(args) == 0 {
+		printConfigUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "get":
+		cmdConfigGet(args[1:])
+	case "set":
+		cmdConfigSet(args[1:])
+	case "unset":
+		cmdConfigUnset(args[1:])
+	case "list":
+		cmdConfigList(args[1:])
+	case "edit":
+		cmdConfigEdit(args[1:])
+	case "path":
+		cmdConfigPath(args[1:])
+	case "validate":
+		cmdConfigValidate(args[1:])
+	case "help", "-h", "--help":
+		printConfigUsage()
+	default:
+		fmt.Printf("Unknown config command: %s\n", args[0])
+		printConfigUsage()
+		os.Exit(1)
+	}
+}
+
+func printConfigUsage() {
+	fmt.Println("Usage: claude-insights-agent config <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  get <key>          Print the effective value of a setting (API keys as fingerprints)")
+	fmt.Println("  set <key> <value>  Write a setting to the config file")
+	fmt.Println("  unset <key>        Remove a setting from the config file")
+	fmt.Println("  list               List every setting and where it came from")
+	fmt.Println("  edit               Open the config file in $VISUAL or $EDITOR")
+	fmt.Println("  path               Print the config file path")
+	fmt.Println("  validate           Report every problem in the config file with its line")
+	fmt.Println()
+	fmt.Println("Keys are dotted, e.g. sharing.level. Lists of strings are comma-separated;")
+	fmt.Println("sinks and sources take YAML or JSON. Comments in the file are kept.")
+}
+
+func cmdConfigGet(args []string) {
+	fs, cf := newFlagSet("config get")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: claude-insights-agent config get <key>")
+		os.Exit(1)
+	}
+
+	resolved, err := cf.resolve()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	f, ok := resolved.Field(fs.Arg(0))
+	if !ok {
+		fmt.Printf("Error: unknown setting %q\n", fs.Arg(0))
+		os.Exit(1)
+	}
+	fmt.Println(displayValue(f))
+}
+
+func cmdConfigSet(args []string) {
+	fs, cf := newFlagSet("config set")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Println("Usage: claude-insights-agent config set <key> <value>")
+		os.Exit(1)
+	}
+	key, value := fs.Arg(0), fs.Arg(1)
+	if err := checkSettable(key, value); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	editConfig(cf, func(doc *config.Document) error {
+		return doc.Set(key, value)
+	})
+}
+
+// secretSetting reports whether a dotted key holds an API key
+func secretSetting(key string) bool {
+	return key == "api_key" || strings.HasSuffix(key, ".api_key")
+}
+
+// displayValue formats a setting for output, API keys as fingerprints,
+// also those of sinks
+func displayValue(f config.Field) string {
+	if f.Key == "sinks" {
+		return displaySinks(f.String())
+	}
+	if !secretSetting(f.Key) {
+		return f.String()
+	}
+	if f.String() == "" {
+		return "(not set)"
+	}
+	return credentials.Fingerprint(f.String())
+}
+
+// displaySinks replaces the API keys in the JSON form of the sinks
+// setting with their fingerprints
+func displaySinks(value string) string {
+	var sinks []config.SinkConfig
+	if err := json.Unmarshal([]byte(value), &sinks); err != nil {
+		return "(not shown)"
+	}
+	for i := range sinks {
+		if sinks[i].APIKey != "" {
+			sinks[i].APIKey = credentials.Fingerprint(sinks[i].APIKey)
+		}
+	}
+	data, err := json.Marshal(sinks)
+	if err != nil {
+		return "(not shown)"
+	}
+	return string(data)
+}
+
+// checkSettable rejects settings config set must not write: an API key,
+// on its own or in a sink, would end up in plain text in the config file
+func checkSettable(key, value string) error {
+	if key == "sinks" {
+		return checkSinksSettable(value)
+	}
+	if !secretSetting(key) {
+		return nil
+	}
+	prefix := strings.TrimSuffix(key, "api_key")
+	return fmt.Errorf("%s would be stored in plain text; set %sapi_key_env, %sapi_key_file or %sapi_key_command instead, "+
+		"or keep the key in the encrypted credential file with 'claude-insights-agent init --api-key-stdin'",
+		key, prefix, prefix, prefix)
+}
+
+// checkSinksSettable rejects a sinks value that carries an API key.
+// Values that do not parse are left for config set to report.
+func checkSinksSettable(value string) error {
+	scratch := config.DefaultConfig()
+	f, _ := scratch.Field("sinks")
+	if err := f.Set(value); err != nil {
+		return nil
+	}
+	for i, sink := range scratch.Sinks {
+		if sink.APIKey != "" {
+			return fmt.Errorf("sinks.%d.api_key would be stored in plain text; give the sink api_key_env, api_key_file, api_key_command "+
+				"or api_key_credential instead", i)
+		}
+	}
+	return nil
+}
+
+func cmdConfigUnset(args []string) {
+	fs, cf := newFlagSet("config unset")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: claude-insights-agent config unset <key>")
+		os.Exit(1)
+	}
+	key := fs.Arg(0)
+
+	editConfig(cf, func(doc *config.Document) error {
+		found, err := doc.Unset(key)
+		if err == nil && !found {
+			fmt.Printf("%s is not set in the config file\n", key)
+		}
+		return err
+	})
+}
+
+// editConfig applies an edit to the config file and saves it, unless the
+// edit makes the config invalid. Problems the file already had do not
+// block the edit, so a config can be built up one setting at a time.
+func editConfig(cf *configFlags, edit func(doc *config.Document) error) {
+	path := cf.configPath()
+	doc, err := config.OpenDocument(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	before, err := doc.Config()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("Run 'claude-insights-agent config edit' to fix the file")
+		os.Exit(1)
+	}
+
+	if err := edit(doc); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	after, err := doc.Config()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	known := make(map[string]bool)
+	for _, p := range before.Problems() {
+		known[p.Message] = true
+	}
+	invalid := false
+	for _, p := range after.Problems() {
+		if !known[p.Message] {
+			fmt.Printf("Error: %v\n", p)
+			invalid = true
+		}
+	}
+	if invalid {
+		fmt.Printf("%s not changed\n", path)
+		os.Exit(1)
+	}
+
+	if err := doc.Save(); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func cmdConfigList(args []string) {
+	fs, cf := newFlagSet("config list")
+	fs.Parse(args)
+
+	resolved, err := cf.resolve()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	printSettings(resolved)
+}
+
+func cmdConfigPath(args []string) {
+	fs, cf := newFlagSet("config path")
+	fs.Parse(args)
+	fmt.Println(cf.configPath())
+}
+
+// cmdConfigEdit opens a copy of the config file in an editor and saves it
+// once it validates
+func cmdConfigEdit(args []string) {
+	fs, cf := newFlagSet("config edit")
+	fs.Parse(args)
+	path := cf.configPath()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte(fmt.Sprintf("version: %d\n", config.CurrentVersion))
+	} else if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tmp, err := os.CreateTemp("", "claude-insights-*.yaml")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if err := runEditor(tmp.Name()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		problems, err := config.Check(tmp.Name())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		invalid := false
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", path, p)
+			invalid = invalid || !p.Warning
+		}
+		if !invalid {
+			break
+		}
+		fmt.Print("Edit again? [Y/n]: ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println()
+		}
+		if err != nil || strings.TrimSpace(strings.ToLower(answer)) == "n" {
+			fmt.Printf("%s not changed\n", path)
+			os.Exit(1)
+		}
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if bytes.Equal(edited, data) {
+		fmt.Println("No changes")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, edited, 0600); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved %s\n", path)
+}
+
+// runEditor opens a file in $VISUAL or $EDITOR, falling back to vi. The
+// variable may include arguments, such as "code --wait".
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", editor, err)
+	}
+	return nil
+}
+
+func cmdConfigValidate(args []string) {
+	fs, cf := newFlagSet("config validate")
+	fs.Parse(args)
+	path := cf.configPath()
+
+	problems, err := config.Check(path)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(problems) == 0 {
+		fmt.Printf("%s: OK\n", path)
+		return
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", path, p)
+	}
+	fmt.Printf("%d problem(s) found\n", len(problems))
+	os.Exit(1)
+}
+
+// migrateConfig upgrades an older config file in place
+func migrateConfig(cf *configFlags) error {
+	m, err := config.Migrate(cf.configPath())
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		fmt.Printf("Upgraded config from version %d to %d (previous version saved as %s)\n", m.From, m.To, m.Backup)
+	}
+	return nil
+}
+
+// printWarnings shows the warnings found while reading the config file
+func printWarnings(resolved *config.Resolved) {
+	for _, w := range resolved.Warnings {
+		fmt.Printf("%s: %s\n", resolved.Path, w)
+	}
+}
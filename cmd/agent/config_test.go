@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/credentials"
+)
+
+func TestCheckSettable(t *testing.T) {
+	tests := []struct {
+		key, value string
+		wantErr    string // Empty if the key may be set
+	}{
+		{"sharing.level", "full", ""},
+		{"server.api_key_env", "KEY", ""},
+		{"server.api_key_credential", "team", ""},
+		{"server.api_key", "sk-1", "server.api_key_env, server.api_key_file or server.api_key_command"},
+		{"sinks", `[{"name":"a","type":"server","url":"https://x","api_key_env":"KEY"}]`, ""},
+		{"sinks", `[{"name":"a","type":"directory","path":"/tmp"},{"name":"b","type":"server","api_key":"sk-1"}]`, "sinks.1.api_key would be stored in plain text"},
+		{"sinks", "- name: a\n  api_key: sk-1\n", "sinks.0.api_key would be stored in plain text"},
+		{"sinks", "not a list", ""}, // Left for config set to report
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := checkSettable(tt.key, tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDisplayValue(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Server.APIKey = "secret-key"
+	cfg.Server.APIKeyEnv = "INSIGHTS_KEY"
+	cfg.Sinks = []config.SinkConfig{
+		{Name: "a", Type: config.SinkServer, APIKeySource: config.APIKeySource{APIKey: "sink-key"}},
+		{Name: "b", Type: config.SinkServer, APIKeySource: config.APIKeySource{APIKeyEnv: "B_KEY"}},
+	}
+	empty := config.DefaultConfig()
+
+	tests := []struct {
+		cfg  *config.Config
+		key  string
+		want string
+	}{
+		{cfg, "server.api_key", credentials.Fingerprint("secret-key")},
+		{empty, "server.api_key", "(not set)"},
+		{cfg, "server.api_key_env", "INSIGHTS_KEY"},
+		{cfg, "sharing.level", "metadata"},
+		{empty, "sinks", "null"},
+	}
+	for _, tt := range tests {
+		f, ok := tt.cfg.Field(tt.key)
+		if !ok {
+			t.Fatalf("no field %s", tt.key)
+		}
+		if got := displayValue(f); got != tt.want {
+			t.Errorf("displayValue(%s) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	f, _ := cfg.Field("sinks")
+	got := displayValue(f)
+	if strings.Contains(got, "sink-key") {
+		t.Errorf("displayValue(sinks) shows the API key: %s", got)
+	}
+	for _, want := range []string{credentials.Fingerprint("sink-key"), "B_KEY"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("displayValue(sinks) = %s, want it to contain %q", got, want)
+		}
+	}
+}
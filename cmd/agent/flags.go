@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+)
+
+// settingFlags are shorthands for frequently overridden settings
+var settingFlags = []struct {
+	name, key, usage string
+}{
+	{"server", "server.url", "server URL"},
+	{"share-level", "sharing.level", "share level: none, metadata or full"},
+	{"interval", "sync.interval", "sync interval in seconds"},
+	{"log-level", "logging.level", "log level: debug, info, warn or error"},
+	{"log-format", "logging.format", "log format: text or json"},
+}
+
+// configFlags collects --config and setting overrides in command line
+// order, so a later flag wins over an earlier one for the same setting
+type configFlags struct {
+	path      string
+	overrides []config.Override
+}
+
+// newFlagSet creates the flag set of a command with the config flags
+func newFlagSet(name string) (*flag.FlagSet, *configFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	cf := &configFlags{}
+
+	fs.StringVar(&cf.path, "config", "", "config file (default $"+config.EnvConfigPath+" or "+config.ConfigPath()+")")
+	for _, sf := range settingFlags {
+		sf := sf
+		fs.Func(sf.name, sf.usage+" ("+sf.key+")", func(v string) error {
+			cf.overrides = append(cf.overrides, config.Override{Key: sf.key, Value: v, Flag: "--" + sf.name})
+			return nil
+		})
+	}
+	fs.Func("set", "override any setting as key=value, e.g. --set sync.retry_attempts=5 (repeatable)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", v)
+		}
+		cf.overrides = append(cf.overrides, config.Override{Key: strings.TrimSpace(key), Value: value, Flag: "--set " + key})
+		return nil
+	})
+	return fs, cf
+}
+
+// resolve builds the effective config from the file, the environment and
+// the flags
+func (cf *configFlags) resolve() (*config.Resolved, error) {
+	return config.Resolve(cf.path, os.Environ(), cf.overrides)
+}
+
+// configPath returns the config file to read and write
+func (cf *configFlags) configPath() string {
+	if cf.path != "" {
+		return config.ExpandPath(cf.path)
+	}
+	if p := os.Getenv(config.EnvConfigPath); p != "" {
+		return config.ExpandPath(p)
+	}
+	return config.ConfigPath()
+}
@@ -3,14 +3,20 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/credentials"
+	"github.com/dkd/claude-insights-agent/internal/dashboard"
+	"github.com/dkd/claude-insights-agent/internal/logging"
 	"github.com/dkd/claude-insights-agent/internal/watcher"
+	"golang.org/x/term"
 )
 
 // version is set via ldflags at build time
@@ -26,13 +32,17 @@ func main() {
 
 	switch cmd {
 	case "init":
-		cmdInit()
+		cmdInit(os.Args[2:])
 	case "run":
-		cmdRun()
+		cmdRun(os.Args[2:])
 	case "sync":
-		cmdSync()
+		cmdSync(os.Args[2:])
 	case "status":
-		cmdStatus()
+		cmdStatus(os.Args[2:])
+	case "dashboard":
+		cmdDashboard(os.Args[2:])
+	case "config":
+		cmdConfig(os.Args[2:])
 	case "version", "-v", "--version":
 		fmt.Printf("claude-insights-agent v%s\n", version)
 	case "help", "-h", "--help":
@@ -47,25 +57,61 @@ func main() {
 func printUsage() {
 	fmt.Println("claude-insights-agent - Sync Claude Code sessions to team server")
 	fmt.Println()
-	fmt.Println("Usage: claude-insights-agent <command>")
+	fmt.Println("Usage: claude-insights-agent <command> [flags]")
 	fmt.Println()
 	fmt.Println("Commands:")
-	fmt.Println("  init      Initialize configuration (interactive)")
+	fmt.Println("  init      Initialize configuration (--non-interactive for scripts)")
 	fmt.Println("  run       Start continuous sync daemon")
 	fmt.Println("  sync      Run one-time sync")
 	fmt.Println("  status    Show sync status")
+	fmt.Println("  dashboard Serve a local web dashboard (--listen addr, --token secret)")
+	fmt.Println("  config    Get, set, edit or validate settings (see 'config help')")
 	fmt.Println("  version   Show version")
 	fmt.Println("  help      Show this help")
+	fmt.Println()
+	fmt.Println("Flags for init, run, sync, status, dashboard and config:")
+	fmt.Println("  --config path        Config file")
+	fmt.Println("  --server url         Server URL")
+	fmt.Println("  --share-level level  none, metadata or full")
+	fmt.Println("  --interval seconds   Sync interval")
+	fmt.Println("  --log-level level    debug, info, warn or error")
+	fmt.Println("  --log-format format  text or json")
+	fmt.Println("  --set key=value      Any setting, e.g. --set sync.retry_attempts=5")
+	fmt.Println()
+	fmt.Println("Every setting can also be set through the environment as")
+	fmt.Println("CLAUDE_INSIGHTS_<KEY>, e.g. CLAUDE_INSIGHTS_SHARING_LEVEL=metadata.")
+	fmt.Println("Flags override the environment, which overrides the config file.")
 }
 
-func cmdInit() {
-	cfgPath := config.ConfigPath()
+func cmdInit(args []string) {
+	fs, cf := newFlagSet("init")
+	nonInteractive := fs.Bool("non-interactive", false, "take all settings from flags and the environment without prompting")
+	force := fs.Bool("force", false, "overwrite an existing config")
+	apiKeyStdin := fs.Bool("api-key-stdin", false, "read the API key from stdin (implies --non-interactive)")
+	fs.Parse(args)
+	cfgPath := cf.configPath()
+	if *apiKeyStdin {
+		*nonInteractive = true
+	}
+
+	// Flags and the environment preset the answers
+	resolved, err := config.Build(os.Environ(), cf.overrides)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg := resolved.Config
+
+	reader := bufio.NewReader(os.Stdin)
 
 	// Check if config already exists
-	if _, err := os.Stat(cfgPath); err == nil {
+	if _, err := os.Stat(cfgPath); err == nil && !*force {
+		if *nonInteractive {
+			fmt.Printf("Config already exists at %s (use --force to overwrite)\n", cfgPath)
+			os.Exit(1)
+		}
 		fmt.Printf("Config already exists at %s\n", cfgPath)
 		fmt.Print("Overwrite? [y/N]: ")
-		reader := bufio.NewReader(os.Stdin)
 		answer, _ := reader.ReadString('\n')
 		if strings.TrimSpace(strings.ToLower(answer)) != "y" {
 			fmt.Println("Aborted")
@@ -73,20 +119,58 @@ func cmdInit() {
 		}
 	}
 
-	cfg := config.DefaultConfig()
+	if *apiKeyStdin {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Printf("Error reading API key from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.Server.APIKeySource = config.APIKeySource{APIKey: strings.TrimSpace(line)}
+	}
+	if !*nonInteractive {
+		promptConfig(cfg, reader)
+	}
 
-	reader := bufio.NewReader(os.Stdin)
+	// Validate
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("Configuration error: %v\n", err)
+		os.Exit(1)
+	}
 
+	// A key given in plain text is kept in the encrypted credential file
+	if err := storeAPIKey(cfg, cfgPath); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Save
+	if err := cfg.Save(cfgPath); err != nil {
+		fmt.Printf("Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Configuration saved to %s\n", cfgPath)
+	fmt.Println("Run 'claude-insights-agent run' to start syncing")
+}
+
+// promptConfig asks for the main settings, offering the current values
+// as defaults
+func promptConfig(cfg *config.Config, reader *bufio.Reader) {
 	// Server URL
 	fmt.Printf("Server URL [%s]: ", cfg.Server.URL)
 	if url, _ := reader.ReadString('\n'); strings.TrimSpace(url) != "" {
 		cfg.Server.URL = strings.TrimSpace(url)
 	}
 
-	// API Key
-	fmt.Print("API Key: ")
-	apiKey, _ := reader.ReadString('\n')
-	cfg.Server.APIKey = strings.TrimSpace(apiKey)
+	// API Key, unless the environment or flags name one
+	if !cfg.Server.APIKeySource.IsSet() {
+		apiKey, err := readSecret(reader, "API Key: ")
+		if err != nil {
+			fmt.Printf("Error reading API key: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.Server.APIKey = apiKey
+	}
 
 	// Share level
 	fmt.Println()
@@ -113,25 +197,49 @@ func cmdInit() {
 			cfg.Sync.Interval = i
 		}
 	}
+	fmt.Println()
+}
 
-	// Validate
-	if err := cfg.Validate(); err != nil {
-		fmt.Printf("Configuration error: %v\n", err)
-		os.Exit(1)
+// storeAPIKey moves a plain text server API key into the encrypted
+// credential file next to the config file at cfgPath and refers to it
+// from the config instead
+func storeAPIKey(cfg *config.Config, cfgPath string) error {
+	key := cfg.Server.APIKey
+	if key == "" {
+		return nil
 	}
-
-	// Save
-	if err := cfg.Save(cfgPath); err != nil {
-		fmt.Printf("Error saving config: %v\n", err)
-		os.Exit(1)
+	if err := config.OpenCredentials(cfgPath).Set(config.DefaultSinkName, key); err != nil {
+		return fmt.Errorf("store API key: %w", err)
 	}
+	cfg.Server.APIKeySource = config.APIKeySource{APIKeyCredential: config.DefaultSinkName}
+	fmt.Printf("API key %s stored in %s\n", credentials.Fingerprint(key), config.CredentialsPath(cfgPath))
+	return nil
+}
 
-	fmt.Printf("\nConfiguration saved to %s\n", cfgPath)
-	fmt.Println("Run 'claude-insights-agent run' to start syncing")
+// readSecret prompts for a secret, without echo if stdin is a terminal
+func readSecret(reader *bufio.Reader, prompt string) (string, error) {
+	fmt.Print(prompt)
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+	secret, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
 }
 
-func cmdRun() {
-	cfg, err := loadConfig()
+func cmdRun(args []string) {
+	fs, cf := newFlagSet("run")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(cf)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		fmt.Println("Run 'claude-insights-agent init' to create config")
@@ -142,28 +250,101 @@ func cmdRun() {
 
 	w := watcher.New(cfg, logger)
 
+	if cfg.Metrics.Listen != "" {
+		srv := startHTTPServer(cfg.Metrics.Listen, w, logger)
+		defer srv.Close()
+	}
+
 	// Handle shutdown signals
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloadOnChange(cf, w, logger, stop)
+
 	go func() {
 		<-sigCh
-		logger.Println("Shutting down...")
+		logger.Info("Shutting down")
 		w.Stop()
 	}()
 
 	fmt.Println("Starting claude-insights-agent...")
-	fmt.Printf("Syncing to %s (share level: %s)\n", cfg.Server.URL, cfg.Sharing.Level)
+	for _, d := range cfg.Destinations() {
+		fmt.Printf("Syncing to %s (share level: %s)\n", d.Target(), d.Sharing.Level)
+	}
 	fmt.Println("Press Ctrl+C to stop")
 
 	if err := w.Start(); err != nil {
-		logger.Printf("Error: %v\n", err)
+		logger.Error("Watcher failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// startHTTPServer serves the metrics endpoint in the background
+func startHTTPServer(addr string, w *watcher.Watcher, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", w.Metrics().Handler())
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics server failed", "listen", addr, "error", err)
+		}
+	}()
+	fmt.Printf("Serving metrics on http://%s/metrics\n", addr)
+	return srv
+}
+
+// envDashboardToken names the environment variable holding the default
+// dashboard token
+const envDashboardToken = config.EnvPrefix + "DASHBOARD_TOKEN"
+
+func cmdDashboard(args []string) {
+	fs, cf := newFlagSet("dashboard")
+	listen := fs.String("listen", "127.0.0.1:8765", "address to serve the dashboard on")
+	token := fs.String("token", os.Getenv(envDashboardToken), "token required to open the dashboard (default $"+envDashboardToken+")")
+	fs.Parse(args)
+
+	// Anyone who can reach a non-loopback address could read the unfiltered
+	// sessions
+	if !dashboard.IsLoopback(*listen) && *token == "" {
+		fmt.Printf("Error: --listen %s is reachable from other machines; set --token or $%s\n", *listen, envDashboardToken)
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig(cf)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("Run 'claude-insights-agent init' to create config")
+		os.Exit(1)
+	}
+
+	logger := setupLogger(cfg)
+	w := watcher.New(cfg, logger)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           dashboard.New(w, logger, dashboard.Options{Hosts: dashboard.ListenHosts(*listen), Token: *token}).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if *token != "" {
+		fmt.Printf("Dashboard at http://%s/?token=<token>\n", *listen)
+	} else {
+		fmt.Printf("Dashboard at http://%s/\n", *listen)
+	}
+	fmt.Println("Press Ctrl+C to stop")
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func cmdSync() {
-	cfg, err := loadConfig()
+func cmdSync(args []string) {
+	fs, cf := newFlagSet("sync")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(cf)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		fmt.Println("Run 'claude-insights-agent init' to create config")
@@ -182,74 +363,156 @@ func cmdSync() {
 	fmt.Println("Sync complete")
 }
 
-func cmdStatus() {
-	cfgPath := config.ConfigPath()
+func cmdStatus(args []string) {
+	fs, cf := newFlagSet("status")
+	fs.Parse(args)
 	statePath := config.StatePath()
 
 	// Check config
-	cfg, err := config.Load(cfgPath)
+	resolved, err := cf.resolve()
 	if err != nil {
-		fmt.Println("Status: NOT CONFIGURED")
-		fmt.Printf("Config file: %s (missing)\n", cfgPath)
-		fmt.Println("Run 'claude-insights-agent init' to create config")
-		return
+		fmt.Println("Status: CONFIG ERROR")
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg := resolved.Config
+	if err := cfg.Validate(); err != nil {
+		if !resolved.FileFound {
+			fmt.Println("Status: NOT CONFIGURED")
+			fmt.Printf("Config file: %s (missing)\n", resolved.Path)
+			fmt.Println("Run 'claude-insights-agent init' to create config")
+			return
+		}
+		fmt.Printf("Status: INVALID CONFIG (%v)\n", err)
+	} else {
+		fmt.Println("Status: CONFIGURED")
 	}
 
-	fmt.Println("Status: CONFIGURED")
-	fmt.Printf("Config file: %s\n", cfgPath)
-	fmt.Printf("Server: %s\n", cfg.Server.URL)
-	fmt.Printf("Share level: %s\n", cfg.Sharing.Level)
+	if resolved.FileFound {
+		fmt.Printf("Config file: %s\n", resolved.Path)
+		printWarnings(resolved)
+	} else {
+		fmt.Printf("Config file: %s (missing, using environment and flags)\n", resolved.Path)
+	}
+	if len(cfg.Sinks) == 0 {
+		fmt.Printf("Server: %s\n", cfg.Server.URL)
+		fmt.Printf("API key: %s\n", describeAPIKey(cfg.Server.APIKeySource, resolved.Path))
+		fmt.Printf("Share level: %s\n", cfg.Sharing.Level)
+		fmt.Printf("Anonymize paths: %v\n", cfg.Sharing.AnonymizePaths)
+	} else {
+		fmt.Println("Sinks:")
+		for _, d := range cfg.Destinations() {
+			fmt.Printf("  %s: %s %s (share level: %s, anonymize paths: %v)\n",
+				d.Name, d.Type, d.Target(), d.Sharing.Level, d.Sharing.AnonymizePaths)
+			if d.Type == config.SinkServer {
+				fmt.Printf("    API key: %s\n", describeAPIKey(d.APIKeySource, resolved.Path))
+			}
+		}
+	}
+	fmt.Println("Sources:")
+	for _, src := range cfg.ClaudeSources() {
+		level := ""
+		if src.ShareLevel != "" {
+			level = fmt.Sprintf(" (share level at most %s)", src.ShareLevel)
+		}
+		fmt.Printf("  %s: %s%s\n", src.Label, src.Path, level)
+	}
 	fmt.Printf("Sync interval: %ds\n", cfg.Sync.Interval)
-	fmt.Printf("Anonymize paths: %v\n", cfg.Sharing.AnonymizePaths)
+	fmt.Println()
+
+	printSettings(resolved)
 	fmt.Println()
 
 	// Check state
-	logger := log.New(os.Stderr, "", 0)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
 	w := watcher.New(cfg, logger)
 	stats := w.GetStats()
 
 	fmt.Printf("State file: %s\n", statePath)
-	fmt.Printf("Sessions synced: %d\n", stats.TotalSynced)
+	for _, s := range stats.Sinks {
+		label := ""
+		if len(stats.Sinks) > 1 {
+			label = s.Name + ": "
+		}
+		fmt.Printf("%sSessions synced: %d\n", label, s.TotalSynced)
+		if s.Quarantined > 0 {
+			fmt.Printf("%sRejected: %d (see %s)\n", label, s.Quarantined, statePath)
+		}
+	}
 	if !stats.LastSync.IsZero() {
 		fmt.Printf("Last sync: %s\n", stats.LastSync.Format("2006-01-02 15:04:05"))
 	}
 }
 
-func loadConfig() (*config.Config, error) {
-	cfg, err := config.Load(config.ConfigPath())
-	if err != nil {
-		return nil, err
+// describeAPIKey shows the fingerprint of a key and where it comes from
+func describeAPIKey(src config.APIKeySource, configPath string) string {
+	if !src.IsSet() {
+		return "not set"
 	}
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+	key, err := src.Resolve(configPath)
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
 	}
-	return cfg, nil
+	return fmt.Sprintf("%s (from %s)", credentials.Fingerprint(key), src.Origin())
 }
 
-func setupLogger(cfg *config.Config) *log.Logger {
-	var output *os.File
-
-	if cfg.Logging.File != "" {
-		// Expand ~ to home directory
-		logPath := cfg.Logging.File
-		if strings.HasPrefix(logPath, "~") {
-			home, _ := os.UserHomeDir()
-			logPath = strings.Replace(logPath, "~", home, 1)
+// printSettings lists every effective setting and where it came from.
+// Secrets are shown only as fingerprints.
+func printSettings(resolved *config.Resolved) {
+	fmt.Println("Settings:")
+	fields := resolved.Fields()
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f.Key))
+	}
+	for _, f := range fields {
+		value := displayValue(f)
+		switch {
+		case f.Key == "sinks":
+			value = fmt.Sprintf("%d configured", len(resolved.Sinks))
+		case f.Key == "sources":
+			value = fmt.Sprintf("%d configured", len(resolved.Sources))
 		}
+		fmt.Printf("  %-*s  %-30s  [%s]\n", width, f.Key, value, resolved.Origins[f.Key])
+	}
+}
 
-		// Ensure directory exists
-		os.MkdirAll(strings.TrimSuffix(logPath, "/"+strings.Split(logPath, "/")[len(strings.Split(logPath, "/"))-1]), 0755)
-
-		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			fmt.Printf("Warning: could not open log file: %v\n", err)
-			output = os.Stdout
-		} else {
-			output = f
+func loadConfig(cf *configFlags) (*config.Config, error) {
+	if err := migrateConfig(cf); err != nil {
+		return nil, err
+	}
+	resolved, err := cf.resolve()
+	if err != nil {
+		return nil, err
+	}
+	printWarnings(resolved)
+	if err := resolved.Validate(); err != nil {
+		if !resolved.FileFound {
+			return nil, fmt.Errorf("%w (no config file at %s)", err, resolved.Path)
 		}
-	} else {
-		output = os.Stdout
+		return nil, err
+	}
+	if err := resolved.ResolveAPIKeys(resolved.Path); err != nil {
+		return nil, err
+	}
+	return resolved.Config, nil
+}
+
+// setupLogger creates the logger described by the logging config, falling
+// back to stdout if the log file cannot be opened. The file stays open
+// for the life of the process.
+func setupLogger(cfg *config.Config) *slog.Logger {
+	logger, _, err := logging.New(cfg.Logging, os.Stdout)
+	if err == nil {
+		return logger
 	}
 
-	return log.New(output, "[insights] ", log.Ldate|log.Ltime)
+	fmt.Printf("Warning: could not open log file: %v\n", err)
+	stdout := cfg.Logging
+	stdout.File = ""
+	logger, _, err = logging.New(stdout, os.Stdout)
+	if err != nil {
+		return slog.New(slog.NewTextHandler(os.Stdout, nil))
+	}
+	return logger
 }
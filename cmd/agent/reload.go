@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/watcher"
+)
+
+// configPollInterval is how often run checks the config file for changes
+const configPollInterval = 2 * time.Second
+
+// reloadOnChange reloads the config of a running watcher on SIGHUP and
+// whenever the config file changes, until stop is closed. An invalid
+// config is logged and the running one kept.
+func reloadOnChange(cf *configFlags, w *watcher.Watcher, logger *slog.Logger, stop <-chan struct{}) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	path := cf.configPath()
+	last, _ := os.ReadFile(path)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hupCh:
+			last, _ = os.ReadFile(path)
+			logger.Info("Reloading config", "reason", "SIGHUP", "path", path)
+		case <-ticker.C:
+			// Compare contents rather than modification times, so saving
+			// an unchanged file does not reload
+			data, err := os.ReadFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				logger.Warn("Could not read config file", "path", path, "error", err)
+				continue
+			}
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			logger.Info("Reloading config", "reason", "file changed", "path", path)
+		case <-stop:
+			return
+		}
+
+		cfg, err := loadConfig(cf)
+		if err == nil {
+			err = w.Reload(cfg)
+		}
+		if err != nil {
+			logger.Error("Config reload rejected, keeping the running config", "path", path, "error", err)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/dkd/claude-insights-agent/internal/parser"
@@ -16,6 +17,10 @@ type Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+
+	mu         sync.Mutex
+	encoding   string // Content-Encoding for request bodies
+	negotiated bool   // Encoding was picked from the server's /health response
 }
 
 // New creates a new API client
@@ -26,189 +31,192 @@ func New(baseURL, apiKey string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		encoding: EncodingGzip,
 	}
 }
 
 // SessionResponse is the server response for session upload
 type SessionResponse struct {
-	Status    string   `json:"status"`
-	SessionID string   `json:"session_id"`
-	Warnings  []string `json:"warnings"`
+	ItemStatus
+	SessionID string `json:"session_id"`
 }
 
 // PlanResponse is the server response for plan upload
 type PlanResponse struct {
-	Status   string   `json:"status"`
-	Name     string   `json:"name"`
-	Warnings []string `json:"warnings"`
+	ItemStatus
+	Name     string `json:"name"`
+	Source   string `json:"source,omitempty"` // Source label the plan was sent with
+	Revision int    `json:"revision,omitempty"`
 }
 
 // Upload sends a session to the server
 func (c *Client) Upload(s *parser.Session) (*SessionResponse, error) {
-	data, err := json.Marshal(s)
-	if err != nil {
-		return nil, fmt.Errorf("marshal session: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/sessions", bytes.NewReader(data))
+	key, err := SessionKey(s)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", c.apiKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, ErrUnauthorized
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
+		return nil, err
 	}
 
 	var result SessionResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("parse response: %w", err)
+	if err := c.post("/api/v1/sessions", key, s, &result); err != nil {
+		return nil, err
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
 	}
-
 	return &result, nil
 }
 
-// UploadBatch sends multiple sessions to the server
+// UploadBatch sends multiple sessions to the server. The server reports a
+// status per session; callers match results by session ID since the
+// response may be in a different order or miss items.
 func (c *Client) UploadBatch(sessions []*parser.Session) ([]*SessionResponse, error) {
-	data, err := json.Marshal(sessions)
-	if err != nil {
-		return nil, fmt.Errorf("marshal sessions: %w", err)
+	keys := make([]string, len(sessions))
+	for i, s := range sessions {
+		key, err := SessionKey(s)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/sessions/batch", bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", c.apiKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+	var raw json.RawMessage
+	if err := c.post("/api/v1/sessions/batch", batchKey(keys), sessions, &raw); err != nil {
+		return nil, err
 	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, ErrUnauthorized
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
-	}
-
 	var results []*SessionResponse
-	if err := json.Unmarshal(body, &results); err != nil {
+	if err := decodeBatch(raw, &results); err != nil {
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
-
 	return results, nil
 }
 
 // UploadPlan sends a plan to the server
 func (c *Client) UploadPlan(p *parser.Plan) (*PlanResponse, error) {
-	data, err := json.Marshal(p)
-	if err != nil {
-		return nil, fmt.Errorf("marshal plan: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/plans", bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", c.apiKey)
-
-	resp, err := c.httpClient.Do(req)
+	key, err := planKey(p)
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, ErrUnauthorized
-	}
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
+		return nil, err
 	}
 
 	var result PlanResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("parse response: %w", err)
+	if err := c.post("/api/v1/plans", key, p, &result); err != nil {
+		return nil, err
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
 	}
-
 	return &result, nil
 }
 
-// UploadPlanBatch sends multiple plans to the server
+// UploadPlanBatch sends multiple plans to the server. Results are matched
+// to plans with PlanResults.
 func (c *Client) UploadPlanBatch(plans []*parser.Plan) ([]*PlanResponse, error) {
-	data, err := json.Marshal(plans)
-	if err != nil {
-		return nil, fmt.Errorf("marshal plans: %w", err)
+	keys := make([]string, len(plans))
+	for i, p := range plans {
+		key, err := planKey(p)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/plans/batch", bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+	var raw json.RawMessage
+	if err := c.post("/api/v1/plans/batch", batchKey(keys), plans, &raw); err != nil {
+		return nil, err
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", c.apiKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+	var results []*PlanResponse
+	if err := decodeBatch(raw, &results); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
 	}
-	defer resp.Body.Close()
+	return results, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
+// SessionBatches splits sessions into batches whose compressed size stays
+// below maxBytes
+func (c *Client) SessionBatches(sessions []*parser.Session, maxBytes int) [][]*parser.Session {
+	return splitBatches(sessions, maxBytes, c.Encoding())
+}
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, ErrUnauthorized
-	}
+// PlanBatches splits plans into batches whose compressed size stays below
+// maxBytes
+func (c *Client) PlanBatches(plans []*parser.Plan, maxBytes int) [][]*parser.Plan {
+	return splitBatches(plans, maxBytes, c.Encoding())
+}
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error %d: %s", resp.StatusCode, string(body))
-	}
+// Encoding returns the Content-Encoding currently used for request bodies
+func (c *Client) Encoding() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encoding
+}
 
-	var results []*PlanResponse
-	if err := json.Unmarshal(body, &results); err != nil {
-		return nil, fmt.Errorf("parse response: %w", err)
+// post marshals payload, compresses it and sends it to path, decoding the
+// JSON response into out. The request carries the payload hash and, if key
+// is not empty, an idempotency key. A 415 response makes the client fall
+// back to a simpler encoding and retry.
+func (c *Client) post(path, key string, payload, out any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	hash := hashBytes(data)
+
+	rejected := make(map[string]bool) // Encodings answered with 415
+	for {
+		encoding := c.Encoding()
+		body, err := compress(data, encoding)
+		if err != nil {
+			return fmt.Errorf("compress payload: %w", err)
+		}
+
+		req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", c.apiKey)
+		req.Header.Set(HeaderContentHash, hash)
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		if encoding != EncodingIdentity {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return TransportError("send request", err)
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return TransportError("read response", err)
+		}
+
+		if resp.StatusCode == http.StatusUnsupportedMediaType && encoding != EncodingIdentity {
+			rejected[encoding] = true
+			c.setEncoding(fallbackEncoding(encoding, resp.Header.Get("Accept-Encoding"), rejected))
+			continue
+		}
+
+		if resp.StatusCode >= 400 {
+			return ResponseError(resp, respBody)
+		}
+
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("parse response: %w", err)
+		}
+
+		return nil
 	}
+}
 
-	return results, nil
+// setEncoding switches the request body encoding
+func (c *Client) setEncoding(encoding string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.encoding = encoding
 }
 
 // Health checks if the server is reachable
@@ -220,18 +228,30 @@ func (c *Client) Health() error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("server unreachable: %w", err)
+		return TransportError("server unreachable", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server unhealthy: status %d", resp.StatusCode)
-	}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			// The server is up but not healthy; retrying later may help
+			return &APIError{
+				Kind:       KindRetryable,
+				StatusCode: resp.StatusCode,
+				Message:    "server unhealthy",
+			}
+		}
+		return ResponseError(resp, body)
+	}
+
+	// Servers advertise supported request encodings via Accept-Encoding
+	c.mu.Lock()
+	if !c.negotiated {
+		c.encoding = preferredEncoding(resp.Header.Get("Accept-Encoding"))
+		c.negotiated = true
+	}
+	c.mu.Unlock()
 
 	return nil
 }
-
-// Errors
-var (
-	ErrUnauthorized = fmt.Errorf("unauthorized: invalid API key")
-)
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Per-item statuses returned by batch endpoints. Servers may also report
+// other success statuses ("created", "updated", "duplicate").
+const (
+	StatusOK       = "ok"
+	StatusRejected = "rejected" // Item is invalid and must not be resent
+	StatusRetry    = "retry"    // Item failed transiently and may be resent
+	StatusError    = "error"    // Legacy spelling of rejected
+)
+
+// ItemStatus is the outcome of a single item in an upload response
+type ItemStatus struct {
+	Status    string   `json:"status"`
+	ErrorCode string   `json:"error_code,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Warnings  []string `json:"warnings"`
+}
+
+// Succeeded reports whether the server accepted the item
+func (s *ItemStatus) Succeeded() bool {
+	switch s.Status {
+	case StatusRejected, StatusRetry, StatusError:
+		return false
+	}
+	return s.Error == ""
+}
+
+// Retryable reports whether a failed item may be resent
+func (s *ItemStatus) Retryable() bool {
+	return s.Status == StatusRetry
+}
+
+// Err returns the item failure as an API error, or nil on success
+func (s *ItemStatus) Err() error {
+	if s.Succeeded() {
+		return nil
+	}
+	kind := KindNonRetryable
+	if s.Retryable() {
+		kind = KindRetryable
+	}
+	msg := s.Error
+	if msg == "" {
+		msg = s.Status
+	}
+	if s.ErrorCode != "" {
+		msg = s.ErrorCode + ": " + msg
+	}
+	return &APIError{Kind: kind, Message: msg}
+}
+
+// decodeBatch decodes a batch response that is either a bare array of
+// items (legacy servers) or an object with a "results" array
+func decodeBatch(body []byte, out any) error {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapper struct {
+			Results json.RawMessage `json:"results"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapper); err != nil {
+			return err
+		}
+		trimmed = wrapper.Results
+	}
+	return json.Unmarshal(trimmed, out)
+}
+
+// SessionResults indexes batch responses by session ID
+func SessionResults(responses []*SessionResponse) map[string]*SessionResponse {
+	byID := make(map[string]*SessionResponse, len(responses))
+	for _, r := range responses {
+		if r != nil && r.SessionID != "" {
+			byID[r.SessionID] = r
+		}
+	}
+	return byID
+}
+
+// PlanResults matches batch responses to the plans sent and returns the
+// response to each plan, or nil if there is none. Responses are matched by
+// source, name and revision; by source and name from servers unaware of
+// revisions; and by position from servers that do not echo the source.
+func PlanResults(plans []*parser.Plan, responses []*PlanResponse) []*PlanResponse {
+	byKey := make(map[PlanKey]*PlanResponse, len(responses))
+	for _, r := range responses {
+		if r != nil && r.Name != "" {
+			byKey[PlanKey{parser.PlanKey(r.Source, r.Name), r.Revision}] = r
+		}
+	}
+
+	matched := make([]*PlanResponse, len(plans))
+	for i, p := range plans {
+		resp := byKey[PlanKey{p.Key(), p.Revision}]
+		if resp == nil {
+			resp = byKey[PlanKey{Key: p.Key()}]
+		}
+		if resp == nil && len(responses) == len(plans) {
+			if r := responses[i]; r != nil && r.Source == "" && r.Name == p.Name && (r.Revision == 0 || r.Revision == p.Revision) {
+				resp = r
+			}
+		}
+		matched[i] = resp
+	}
+	return matched
+}
+
+// PlanKey identifies a plan revision in batch responses by the plan's
+// source-qualified key, see parser.PlanKey
+type PlanKey struct {
+	Key      string
+	Revision int
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantIDs []string
+		wantErr bool
+	}{
+		{"bare array", `[{"session_id":"a","status":"ok"},{"session_id":"b","status":"ok"}]`, []string{"a", "b"}, false},
+		{"results object", `{"results":[{"session_id":"a","status":"ok"}],"count":1}`, []string{"a"}, false},
+		{"leading whitespace", "\n  {\"results\":[{\"session_id\":\"a\"}]}", []string{"a"}, false},
+		{"empty array", `[]`, nil, false},
+		{"object without results", `{"ok":true}`, nil, true},
+		{"invalid", `not json`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []*SessionResponse
+			err := decodeBatch([]byte(tt.body), &results)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if len(results) != len(tt.wantIDs) {
+				t.Fatalf("results = %d, want %d", len(results), len(tt.wantIDs))
+			}
+			for i, r := range results {
+				if r.SessionID != tt.wantIDs[i] {
+					t.Errorf("result %d = %q, want %q", i, r.SessionID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestItemStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        ItemStatus
+		wantSucceeded bool
+		wantRetryable bool
+		wantErr       string
+		wantKind      ErrorKind
+	}{
+		{"ok", ItemStatus{Status: StatusOK}, true, false, "", 0},
+		{"other success", ItemStatus{Status: "duplicate"}, true, false, "", 0},
+		{"missing status", ItemStatus{}, true, false, "", 0},
+		{"error message without status", ItemStatus{Error: "broken"}, false, false, "broken", KindNonRetryable},
+		{"rejected", ItemStatus{Status: StatusRejected, ErrorCode: "invalid", Error: "bad model"}, false, false, "invalid: bad model", KindNonRetryable},
+		{"legacy error", ItemStatus{Status: StatusError}, false, false, "error", KindNonRetryable},
+		{"retry", ItemStatus{Status: StatusRetry, Error: "busy"}, false, true, "busy", KindRetryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.Succeeded(); got != tt.wantSucceeded {
+				t.Errorf("Succeeded = %v, want %v", got, tt.wantSucceeded)
+			}
+			if got := tt.status.Retryable(); got != tt.wantRetryable {
+				t.Errorf("Retryable = %v, want %v", got, tt.wantRetryable)
+			}
+			err := tt.status.Err()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Err = %v, want nil", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Message != tt.wantErr || apiErr.Kind != tt.wantKind {
+				t.Errorf("Err = %#v, want %q of kind %v", err, tt.wantErr, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestPlanResults(t *testing.T) {
+	plan := func(source, name string, revision int) *parser.Plan {
+		return &parser.Plan{Source: source, Name: name, Revision: revision}
+	}
+
+	tests := []struct {
+		name      string
+		plans     []*parser.Plan
+		responses []*PlanResponse
+		want      []int // Index of the response matched to each plan, -1 for none
+	}{
+		{
+			"by revision",
+			[]*parser.Plan{plan("", "a", 1), plan("", "a", 2)},
+			[]*PlanResponse{{Name: "a", Revision: 2}, {Name: "a", Revision: 1}},
+			[]int{1, 0},
+		},
+		{
+			"by source",
+			[]*parser.Plan{plan("work", "a", 1), plan("default", "a", 1)},
+			[]*PlanResponse{{Name: "a", Revision: 1}, {Name: "a", Source: "work", Revision: 1}},
+			[]int{1, 0},
+		},
+		{
+			"unaware of revisions",
+			[]*parser.Plan{plan("work", "b", 3)},
+			[]*PlanResponse{{Name: "b", Source: "work"}},
+			[]int{0},
+		},
+		{
+			"source not echoed",
+			[]*parser.Plan{plan("work", "a", 1), plan("home", "a", 1)},
+			[]*PlanResponse{{Name: "a", Revision: 1}, {Name: "a", Revision: 1}},
+			[]int{0, 1},
+		},
+		{
+			"source not echoed, other plan in place",
+			[]*parser.Plan{plan("work", "a", 1)},
+			[]*PlanResponse{{Name: "b", Revision: 1}},
+			[]int{-1},
+		},
+		{
+			"missing and unnamed",
+			[]*parser.Plan{plan("", "a", 1), plan("", "c", 1)},
+			[]*PlanResponse{{Revision: 1}, nil, {Name: "c", Revision: 1}},
+			[]int{-1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PlanResults(tt.plans, tt.responses)
+			for i, want := range tt.want {
+				var wantResp *PlanResponse
+				if want >= 0 {
+					wantResp = tt.responses[want]
+				}
+				if got[i] != wantResp {
+					t.Errorf("plan %s: response %+v, want %+v", tt.plans[i].Key(), got[i], wantResp)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionResults(t *testing.T) {
+	responses := []*SessionResponse{{SessionID: "b"}, nil, {}, {SessionID: "a"}}
+	results := SessionResults(responses)
+	if len(results) != 2 || results["a"] != responses[3] || results["b"] != responses[0] {
+		t.Errorf("results = %v", results)
+	}
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Chunked upload protocol for sessions too large for a single request:
+//
+//	POST /api/v1/sessions/uploads                 session header -> UploadStatus
+//	GET  /api/v1/sessions/uploads/{id}            -> UploadStatus
+//	POST /api/v1/sessions/uploads/{id}/chunks     Chunk -> UploadStatus
+//	POST /api/v1/sessions/uploads/{id}/complete   -> SessionResponse
+//
+// The session header is the session without messages, tool calls, token
+// usage and command calls. Those are flattened into one ordered record
+// stream and sent in chunks; the server acknowledges each chunk with the
+// next offset it expects, which is where an interrupted upload resumes.
+
+// Record types in a chunk
+const (
+	RecordMessage     = "message"
+	RecordToolCall    = "tool_call"
+	RecordTokenUsage  = "token_usage"
+	RecordCommandCall = "command_call"
+)
+
+// ChunkRecord is a single message, tool call, token usage or command call item
+type ChunkRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Chunk is an ordered slice of the record stream starting at Offset
+type Chunk struct {
+	Offset  int           `json:"offset"`
+	Records []ChunkRecord `json:"records"`
+}
+
+// UploadStatus is the server state of a chunked upload
+type UploadStatus struct {
+	UploadID   string `json:"upload_id"`
+	NextOffset int    `json:"next_offset"`
+	Total      int    `json:"total"`
+}
+
+// UploadProgress tracks a chunked upload so it can be resumed after a
+// failure. Callers persist it between attempts.
+type UploadProgress struct {
+	UploadID string `json:"upload_id"`
+	Offset   int    `json:"offset"` // Last acknowledged offset
+	Total    int    `json:"total"`
+	Hash     string `json:"hash,omitempty"` // Content hash of the session being uploaded
+}
+
+// SessionSize returns the estimated compressed size of a session upload
+func (c *Client) SessionSize(s *parser.Session) int {
+	return estimateSize(s, c.Encoding())
+}
+
+// UploadChunked uploads a session in chunks of at most chunkBytes of JSON,
+// resuming from progress when it holds an upload ID. Progress is updated
+// as chunks are acknowledged, also when an error is returned.
+func (c *Client) UploadChunked(s *parser.Session, progress *UploadProgress, chunkBytes int) (*SessionResponse, error) {
+	if chunkBytes <= 0 {
+		chunkBytes = DefaultMaxBatchBytes
+	}
+
+	records, err := sessionRecords(s)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := ContentHash(s)
+	if err != nil {
+		return nil, err
+	}
+	key := sessionKey(s.ID, hash)
+
+	// A session that changed since the upload started cannot be resumed:
+	// the records already sent may differ even if their number does not
+	if progress.Hash != hash {
+		progress.UploadID = ""
+	}
+
+	// Resume an existing upload or start a new one
+	var status UploadStatus
+	if progress.UploadID != "" {
+		if err := c.get("/api/v1/sessions/uploads/"+progress.UploadID, &status); err != nil {
+			if err != ErrUploadNotFound {
+				return nil, err
+			}
+			progress.UploadID = "" // Expired on the server, start over
+		}
+	}
+	if progress.UploadID == "" {
+		header := *s
+		header.Messages = nil
+		header.ToolCalls = nil
+		header.TokenUsage = nil
+		header.CommandCalls = nil
+		body := struct {
+			*parser.Session
+			TotalRecords int `json:"total_records"`
+		}{&header, len(records)}
+
+		if err := c.post("/api/v1/sessions/uploads", key, body, &status); err != nil {
+			return nil, err
+		}
+	}
+	progress.UploadID = status.UploadID
+	progress.Offset = status.NextOffset
+	progress.Total = len(records)
+	progress.Hash = hash
+
+	// Stream the remaining records
+	for progress.Offset < len(records) {
+		chunk := Chunk{Offset: progress.Offset}
+		size := 0
+		for i := progress.Offset; i < len(records); i++ {
+			recSize := len(records[i].Data) + len(records[i].Type)
+			if len(chunk.Records) > 0 && size+recSize > chunkBytes {
+				break
+			}
+			chunk.Records = append(chunk.Records, records[i])
+			size += recSize
+		}
+
+		var ack UploadStatus
+		if err := c.post("/api/v1/sessions/uploads/"+progress.UploadID+"/chunks", fmt.Sprintf("%s:chunk:%d", key, chunk.Offset), chunk, &ack); err != nil {
+			return nil, fmt.Errorf("chunk at offset %d: %w", chunk.Offset, err)
+		}
+		if ack.NextOffset <= progress.Offset {
+			return nil, fmt.Errorf("chunk at offset %d: server did not advance (next offset %d)", chunk.Offset, ack.NextOffset)
+		}
+		progress.Offset = ack.NextOffset
+	}
+
+	var result SessionResponse
+	if err := c.post("/api/v1/sessions/uploads/"+progress.UploadID+"/complete", key+":complete", struct{}{}, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// sessionRecords flattens messages, tool calls, token usage and command
+// calls into the ordered record stream of a chunked upload
+func sessionRecords(s *parser.Session) ([]ChunkRecord, error) {
+	records := make([]ChunkRecord, 0, len(s.Messages)+len(s.ToolCalls)+len(s.TokenUsage)+len(s.CommandCalls))
+
+	add := func(recordType string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("marshal %s: %w", recordType, err)
+		}
+		records = append(records, ChunkRecord{Type: recordType, Data: data})
+		return nil
+	}
+
+	for _, m := range s.Messages {
+		if err := add(RecordMessage, m); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range s.ToolCalls {
+		if err := add(RecordToolCall, t); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range s.TokenUsage {
+		if err := add(RecordTokenUsage, u); err != nil {
+			return nil, err
+		}
+	}
+	for _, cmd := range s.CommandCalls {
+		if err := add(RecordCommandCall, cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// get fetches path and decodes the JSON response into out
+func (c *Client) get(path string, out any) error {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return TransportError("send request", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return TransportError("read response", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUploadNotFound
+	case resp.StatusCode >= 400:
+		return ResponseError(resp, body)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/client/fakeserver"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+const apiKey = "test_key"
+
+// testSession returns a session with n messages whose content starts
+// with text
+func testSession(id, text string, n int) *parser.Session {
+	s := &parser.Session{ID: id, Model: "model-" + text}
+	for i := 0; i < n; i++ {
+		s.Messages = append(s.Messages, parser.Message{Seq: i, Role: "user", Content: fmt.Sprintf("%s %d", text, i)})
+	}
+	return s
+}
+
+func TestUploadChunked(t *testing.T) {
+	tests := []struct {
+		name       string
+		failAt     int    // Chunk offset failing on the first attempt, -1 for none
+		retryText  string // Message text of the session on the second attempt
+		wantResume bool   // The second attempt continues the first upload
+	}{
+		{"no failure", -1, "", false},
+		{"resume after failed chunk", 4, "first", true},
+		{"failed first chunk", 0, "first", true},
+		{"changed content restarts", 4, "second", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeserver.New(apiKey)
+			defer srv.Close()
+			c := client.New(srv.URL, apiKey)
+
+			session := testSession("s1", "first", 10)
+			progress := &client.UploadProgress{}
+			chunkBytes := 100 // About two messages per chunk
+
+			if tt.failAt >= 0 {
+				srv.FailChunkAt(tt.failAt)
+				if _, err := c.UploadChunked(session, progress, chunkBytes); err == nil {
+					t.Fatal("first attempt succeeded despite failing chunk")
+				}
+				if progress.UploadID == "" || progress.Offset != tt.failAt {
+					t.Fatalf("progress after failure = %+v, want offset %d", progress, tt.failAt)
+				}
+				session = testSession("s1", tt.retryText, 10)
+			}
+
+			firstID := progress.UploadID
+			resp, err := c.UploadChunked(session, progress, chunkBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !resp.Succeeded() {
+				t.Errorf("response = %+v", resp)
+			}
+			if resumed := firstID != "" && progress.UploadID == firstID; resumed != tt.wantResume {
+				t.Errorf("resumed = %v, want %v", resumed, tt.wantResume)
+			}
+
+			got := srv.Session("s1")
+			if got == nil {
+				t.Fatal("session not stored")
+			}
+			if got.Model != session.Model || len(got.Messages) != len(session.Messages) {
+				t.Fatalf("stored model %q with %d messages, want %q with %d", got.Model, len(got.Messages), session.Model, len(session.Messages))
+			}
+			for i, m := range got.Messages {
+				if m != session.Messages[i] {
+					t.Errorf("message %d = %+v, want %+v", i, m, session.Messages[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUploadChunkedLegacyProgress(t *testing.T) {
+	srv := fakeserver.New(apiKey)
+	defer srv.Close()
+	c := client.New(srv.URL, apiKey)
+
+	// Started by an agent that did not record the content hash
+	first := testSession("s1", "first", 4)
+	srv.FailChunkAt(0)
+	progress := &client.UploadProgress{}
+	c.UploadChunked(first, progress, 100)
+	progress.Hash = ""
+
+	second := testSession("s1", "second", 4)
+	if _, err := c.UploadChunked(second, progress, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Session("s1"); got.Model != second.Model {
+		t.Errorf("stored model %q, want %q", got.Model, second.Model)
+	}
+}
+
+func TestEncodingFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		accept       string // Encodings the server takes and advertises
+		health       bool   // Negotiate through /health first
+		wantEncoding string
+	}{
+		{"gzip", "gzip", true, client.EncodingGzip},
+		{"zstd preferred", "zstd, gzip", true, client.EncodingZstd},
+		{"zstd only, not negotiated", "zstd", false, client.EncodingZstd},
+		{"identity only", "", true, client.EncodingIdentity},
+		{"unknown encodings only", "br", true, client.EncodingIdentity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeserver.New(apiKey)
+			defer srv.Close()
+			srv.AcceptEncoding = tt.accept
+			c := client.New(srv.URL, apiKey)
+
+			if tt.health {
+				if err := c.Health(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := c.Upload(testSession("s1", "text", 3)); err != nil {
+				t.Fatal(err)
+			}
+			if srv.Session("s1") == nil {
+				t.Error("session not stored")
+			}
+			if got := c.Encoding(); got != tt.wantEncoding {
+				t.Errorf("encoding = %q, want %q", got, tt.wantEncoding)
+			}
+		})
+	}
+}
+
+func TestUploadBatchItemStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        string // Injected for session s2, empty for none
+		wantSucceeded bool
+		wantRetryable bool
+		wantKind      client.ErrorKind
+	}{
+		{"ok", "", true, false, 0},
+		{"rejected", client.StatusRejected, false, false, client.KindNonRetryable},
+		{"legacy error", client.StatusError, false, false, client.KindNonRetryable},
+		{"retry", client.StatusRetry, false, true, client.KindRetryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeserver.New(apiKey)
+			defer srv.Close()
+			c := client.New(srv.URL, apiKey)
+			if tt.status != "" {
+				srv.FailItem("s2", tt.status, "injected failure")
+			}
+
+			sessions := []*parser.Session{testSession("s1", "a", 1), testSession("s2", "b", 1)}
+			responses, err := c.UploadBatch(sessions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results := client.SessionResults(responses)
+			if r := results["s1"]; r == nil || !r.Succeeded() {
+				t.Errorf("s1 = %+v", r)
+			}
+
+			r := results["s2"]
+			if r == nil {
+				t.Fatal("s2 missing from results")
+			}
+			if r.Succeeded() != tt.wantSucceeded || r.Retryable() != tt.wantRetryable {
+				t.Errorf("s2 succeeded, retryable = %v, %v, want %v, %v", r.Succeeded(), r.Retryable(), tt.wantSucceeded, tt.wantRetryable)
+			}
+			if err := r.Err(); tt.wantSucceeded != (err == nil) {
+				t.Errorf("s2 error = %v", err)
+			} else if err != nil {
+				var apiErr *client.APIError
+				if !errors.As(err, &apiErr) || apiErr.Kind != tt.wantKind {
+					t.Errorf("s2 error kind = %v, want %v", client.Kind(err), tt.wantKind)
+				}
+			}
+			if stored := srv.Session("s2") != nil; stored != tt.wantSucceeded {
+				t.Errorf("s2 stored = %v, want %v", stored, tt.wantSucceeded)
+			}
+		})
+	}
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		upload func(c *client.Client, s *parser.Session) error
+	}{
+		{"single", func(c *client.Client, s *parser.Session) error {
+			_, err := c.Upload(s)
+			return err
+		}},
+		{"batch", func(c *client.Client, s *parser.Session) error {
+			_, err := c.UploadBatch([]*parser.Session{s})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fakeserver.New(apiKey)
+			defer srv.Close()
+			c := client.New(srv.URL, apiKey)
+			session := testSession("s1", "text", 2)
+
+			// The server stores the session but the response is lost
+			srv.LoseNextResponse()
+			if err := tt.upload(c, session); err == nil {
+				t.Fatal("upload succeeded despite the lost response")
+			}
+			if err := tt.upload(c, session); err != nil {
+				t.Fatal(err)
+			}
+			if got := srv.Replays(); got != 1 {
+				t.Errorf("replays = %d, want 1", got)
+			}
+
+			// New activity is a different request, not a replay
+			if err := tt.upload(c, testSession("s1", "text", 3)); err != nil {
+				t.Fatal(err)
+			}
+			if got := srv.Replays(); got != 1 {
+				t.Errorf("replays after change = %d, want 1", got)
+			}
+			if got := len(srv.Session("s1").Messages); got != 3 {
+				t.Errorf("stored messages = %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestKnownSessions(t *testing.T) {
+	srv := fakeserver.New(apiKey)
+	defer srv.Close()
+	c := client.New(srv.URL, apiKey)
+
+	stored := testSession("s1", "text", 2)
+	if _, err := c.Upload(stored); err != nil {
+		t.Fatal(err)
+	}
+	storedHash, _ := client.ContentHash(stored)
+	changedHash, _ := client.ContentHash(testSession("s1", "text", 3))
+
+	known, err := c.KnownSessions([]string{storedHash, changedHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !known[storedHash] || known[changedHash] || len(known) != 1 {
+		t.Errorf("known = %v", known)
+	}
+}
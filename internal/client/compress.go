@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings for request bodies, in order of preference
+const (
+	EncodingZstd     = "zstd"
+	EncodingGzip     = "gzip"
+	EncodingIdentity = "identity"
+)
+
+// DefaultMaxBatchBytes caps the compressed size of a single batch request
+const DefaultMaxBatchBytes = 4 * 1024 * 1024
+
+// compress encodes data with the given content encoding
+func compress(data []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch encoding {
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(data); err != nil {
+			zw.Close()
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+	case EncodingGzip:
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(data); err != nil {
+			gw.Close()
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+
+	default:
+		return data, nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseAcceptEncoding returns the codings listed in an Accept-Encoding
+// header, skipping those with q=0
+func parseAcceptEncoding(header string) []string {
+	var codings []string
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		rejected := false
+		for _, param := range fields[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if q, err := strconv.ParseFloat(value, 64); key == "q" && err == nil && q == 0 {
+				rejected = true
+			}
+		}
+		if !rejected {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// preferredEncoding picks the best encoding the server accepts. Without
+// zstd or gzip in the header, gzip is still tried: most servers take it
+// without advertising it, and one that does not answers 415, which
+// fallbackEncoding handles.
+func preferredEncoding(header string) string {
+	for _, a := range parseAcceptEncoding(header) {
+		if a == EncodingZstd {
+			return EncodingZstd
+		}
+	}
+	return EncodingGzip
+}
+
+// fallbackEncoding returns the next encoding to try after the server
+// rejected current with 415 Unsupported Media Type. rejected holds the
+// encodings already refused for the request, current included: the
+// advertised encoding is only taken if it is not among them, otherwise
+// the next simpler one is, so the attempts always end at identity.
+func fallbackEncoding(current, acceptHeader string, rejected map[string]bool) string {
+	if next := preferredEncoding(acceptHeader); acceptHeader != "" && !rejected[next] {
+		return next
+	}
+	// Server did not say what it accepts or advertised what it refused:
+	// step down one level
+	if current == EncodingZstd && !rejected[EncodingGzip] {
+		return EncodingGzip
+	}
+	return EncodingIdentity
+}
+
+// splitBatches groups items so the estimated compressed size of each
+// group stays below maxBytes. An item larger than maxBytes gets a batch of
+// its own.
+func splitBatches[T any](items []T, maxBytes int, encoding string) [][]T {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBatchBytes
+	}
+
+	var batches [][]T
+	var current []T
+	currentSize := 0
+	for _, item := range items {
+		size := estimateSize(item, encoding)
+		if len(current) > 0 && currentSize+size > maxBytes {
+			batches = append(batches, current)
+			current, currentSize = nil, 0
+		}
+		current = append(current, item)
+		currentSize += size
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// estimateSize returns the compressed JSON size of a single item
+func estimateSize(v any, encoding string) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	compressed, err := compress(data, encoding)
+	if err != nil {
+		return len(data)
+	}
+	return len(compressed)
+}
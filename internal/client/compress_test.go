@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", nil},
+		{"gzip", []string{"gzip"}},
+		{"ZSTD, gzip;q=0.5", []string{"zstd", "gzip"}},
+		{"zstd;q=0, gzip", []string{"gzip"}},
+		{" , br ,", []string{"br"}},
+	}
+	for _, tt := range tests {
+		if got := parseAcceptEncoding(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAcceptEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestPreferredEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", EncodingGzip},
+		{"zstd, gzip", EncodingZstd},
+		{"gzip", EncodingGzip},
+		{"gzip, zstd;q=0", EncodingGzip},
+		{"br", EncodingGzip},
+		{"identity", EncodingGzip},
+	}
+	for _, tt := range tests {
+		if got := preferredEncoding(tt.header); got != tt.want {
+			t.Errorf("preferredEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestFallbackEncoding(t *testing.T) {
+	tests := []struct {
+		current, header string
+		before          []string // Encodings rejected earlier in the request
+		want            string
+	}{
+		{EncodingZstd, "", nil, EncodingGzip},
+		{EncodingGzip, "", nil, EncodingIdentity},
+		{EncodingZstd, "zstd, gzip", nil, EncodingGzip},
+		{EncodingZstd, "gzip", nil, EncodingGzip},
+		{EncodingGzip, "gzip", nil, EncodingIdentity},
+		{EncodingGzip, "br", nil, EncodingIdentity},
+		{EncodingZstd, "identity", nil, EncodingGzip},
+		{EncodingGzip, "zstd", nil, EncodingZstd},
+		{EncodingGzip, "zstd, gzip", []string{EncodingZstd}, EncodingIdentity},
+		{EncodingZstd, "", []string{EncodingGzip}, EncodingIdentity},
+	}
+	for _, tt := range tests {
+		rejected := map[string]bool{tt.current: true}
+		for _, e := range tt.before {
+			rejected[e] = true
+		}
+		if got := fallbackEncoding(tt.current, tt.header, rejected); got != tt.want {
+			t.Errorf("fallbackEncoding(%q, %q) after %v = %q, want %q", tt.current, tt.header, tt.before, got, tt.want)
+		}
+	}
+}
+
+func TestFallbackEncodingEnds(t *testing.T) {
+	// A server advertising zstd that answers 415 to every encoded body
+	// must be given up on, not alternated between zstd and gzip
+	for _, start := range []string{EncodingZstd, EncodingGzip} {
+		rejected := make(map[string]bool)
+		var tried []string
+		for encoding := start; encoding != EncodingIdentity; encoding = fallbackEncoding(encoding, "zstd, gzip", rejected) {
+			tried = append(tried, encoding)
+			rejected[encoding] = true
+			if len(tried) > 2 {
+				t.Fatalf("fallback from %s does not end: %v", start, tried)
+			}
+		}
+		if len(tried) != 2 {
+			t.Errorf("fallback from %s tried %v, want zstd and gzip once each", start, tried)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data := []byte(strings.Repeat(`{"id":"session"}`, 100))
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		EncodingZstd: func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r)
+			return d, err
+		},
+		EncodingGzip: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		EncodingIdentity: func(r io.Reader) (io.Reader, error) {
+			return r, nil
+		},
+	}
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			compressed, err := compress(data, encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoding != EncodingIdentity && len(compressed) >= len(data) {
+				t.Errorf("compressed size %d, input %d", len(compressed), len(data))
+			}
+			r, err := decode(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("round trip = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSplitBatches(t *testing.T) {
+	item := strings.Repeat("x", 100) // 102 bytes as JSON
+	tests := []struct {
+		name     string
+		items    int
+		maxBytes int
+		want     []int // Batch sizes
+	}{
+		{"empty", 0, 1000, nil},
+		{"one batch", 3, 1000, []int{3}},
+		{"split", 5, 250, []int{2, 2, 1}},
+		{"oversized item alone", 2, 50, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]string, tt.items)
+			for i := range items {
+				items[i] = item
+			}
+			var got []int
+			for _, batch := range splitBatches(items, tt.maxBytes, EncodingIdentity) {
+				got = append(got, len(batch))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batch sizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
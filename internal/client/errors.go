@@ -0,0 +1,155 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies API errors by how the caller should react
+type ErrorKind int
+
+const (
+	// KindRetryable errors are transient: network failures, 5xx, timeouts
+	KindRetryable ErrorKind = iota
+	// KindRateLimited errors ask the client to slow down (429)
+	KindRateLimited
+	// KindAuth errors need a new API key and will not succeed on retry
+	KindAuth
+	// KindNonRetryable errors are rejections of the payload itself (4xx)
+	KindNonRetryable
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindRetryable:
+		return "retryable"
+	case KindRateLimited:
+		return "rate_limited"
+	case KindAuth:
+		return "auth"
+	case KindNonRetryable:
+		return "non_retryable"
+	}
+	return "unknown"
+}
+
+// APIError is an error returned by the insights server or the transport
+type APIError struct {
+	Kind       ErrorKind
+	StatusCode int           // 0 for transport errors
+	Message    string        // Server error message, if any
+	RetryAfter time.Duration // From the Retry-After header, if any
+	Err        error         // Underlying transport error, if any
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	case e.StatusCode != 0:
+		return fmt.Sprintf("server error %d: %s", e.StatusCode, e.Message)
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request may succeed if repeated
+func (e *APIError) Retryable() bool {
+	return e.Kind == KindRetryable || e.Kind == KindRateLimited
+}
+
+// Kind returns the error kind of err. Errors that are not API errors are
+// treated as retryable.
+func Kind(err error) ErrorKind {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind
+	}
+	return KindRetryable
+}
+
+// IsRetryable reports whether err is worth retrying
+func IsRetryable(err error) bool {
+	k := Kind(err)
+	return k == KindRetryable || k == KindRateLimited
+}
+
+// TransportError wraps a failure to reach the server
+func TransportError(message string, err error) error {
+	return &APIError{Kind: KindRetryable, Message: message, Err: err}
+}
+
+// ResponseError classifies an HTTP error response from any endpoint
+func ResponseError(resp *http.Response, body []byte) error {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    serverMessage(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case resp.StatusCode == http.StatusForbidden:
+		apiErr.Kind = KindAuth
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.Kind = KindRateLimited
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode >= 500:
+		apiErr.Kind = KindRetryable
+	default:
+		apiErr.Kind = KindNonRetryable
+	}
+
+	return apiErr
+}
+
+// serverMessage extracts the error message from a response body, which
+// is either {"error": "..."}, {"message": "..."} or plain text
+func serverMessage(body []byte) string {
+	var payload struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Detail  string `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		for _, msg := range []string{payload.Error, payload.Message, payload.Detail} {
+			if msg != "" {
+				return msg
+			}
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// Errors
+var (
+	ErrUnauthorized   = &APIError{Kind: KindAuth, Message: "unauthorized: invalid API key"}
+	ErrUploadNotFound = &APIError{Kind: KindNonRetryable, Message: "chunked upload not found"}
+)
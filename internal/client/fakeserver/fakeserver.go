@@ -0,0 +1,491 @@
+// Package fakeserver is an in-memory stand-in for the insights server,
+// used to exercise the client against the real HTTP protocol locally.
+package fakeserver
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Server records everything uploaded to it
+type Server struct {
+	*httptest.Server
+
+	APIKey string
+
+	// AcceptEncoding is advertised on /health and enforced on uploads
+	AcceptEncoding string
+
+	mu         sync.Mutex
+	failChunks int
+	failAt     map[int]bool // Chunk offsets to fail once
+	failures   []failure
+	items      map[string]client.ItemStatus
+	loseNext   bool
+	responses  map[string][]byte // By idempotency key
+	replays    int
+	hashes     map[string]bool // Content hashes of stored sessions
+	sessions   map[string]*parser.Session
+	plans      []*parser.Plan
+	uploads    map[string]*upload
+	nextID     int
+}
+
+// failure is an injected error response
+type failure struct {
+	status     int
+	retryAfter string
+	message    string
+}
+
+// upload is an in-progress chunked upload
+type upload struct {
+	header  *parser.Session
+	total   int
+	records []client.ChunkRecord
+}
+
+// New starts a fake server accepting the given API key
+func New(apiKey string) *Server {
+	s := &Server{
+		APIKey:         apiKey,
+		AcceptEncoding: "zstd, gzip",
+		sessions:       make(map[string]*parser.Session),
+		uploads:        make(map[string]*upload),
+		items:          make(map[string]client.ItemStatus),
+		responses:      make(map[string][]byte),
+		hashes:         make(map[string]bool),
+		failAt:         make(map[int]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// FailNextChunks makes the next n chunk requests fail with 503
+func (s *Server) FailNextChunks(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failChunks = n
+}
+
+// FailChunkAt makes the next chunk request starting at offset fail with
+// 503, so an upload breaks off after the chunks before it were stored
+func (s *Server) FailChunkAt(offset int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failAt[offset] = true
+}
+
+// FailNext makes the next API request fail with the given status,
+// Retry-After header (empty for none) and error message. Calls queue up.
+func (s *Server) FailNext(status int, retryAfter, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{status, retryAfter, message})
+}
+
+// FailItem makes the next upload of the session ID, plan name or plan
+// name@revision in a batch report the given per-item status (e.g.
+// client.StatusRejected) instead of being stored
+func (s *Server) FailItem(key, status, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = client.ItemStatus{Status: status, ErrorCode: "injected", Error: message}
+}
+
+// itemStatus returns and clears the injected status for key, or ok
+func (s *Server) itemStatus(key string) client.ItemStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.items[key]; ok {
+		delete(s.items, key)
+		return st
+	}
+	return client.ItemStatus{Status: client.StatusOK}
+}
+
+// LoseNextResponse makes the server process the next API request but drop
+// the connection instead of answering, as if the response was lost
+func (s *Server) LoseNextResponse() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loseNext = true
+}
+
+// Replays returns how many requests were answered from the idempotency
+// cache instead of being processed again
+func (s *Server) Replays() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replays
+}
+
+// Session returns an uploaded session by ID
+func (s *Server) Session(id string) *parser.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+// SessionCount returns the number of distinct sessions received
+func (s *Server) SessionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Plans returns all uploaded plans in order of arrival
+func (s *Server) Plans() []*parser.Plan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*parser.Plan(nil), s.plans...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		w.Header().Set("Accept-Encoding", s.AcceptEncoding)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Header.Get("X-API-Key") != s.APIKey {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, f.message), f.status)
+		return
+	}
+	s.mu.Unlock()
+
+	body, err := s.readBody(r)
+	if err != nil {
+		w.Header().Set("Accept-Encoding", s.AcceptEncoding)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if hash := r.Header.Get(client.HeaderContentHash); hash != "" && hash != hashBytes(body) {
+		http.Error(w, `{"error":"content hash mismatch"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Answer repeated requests from the cache
+	key := r.Header.Get(client.HeaderIdempotencyKey)
+	s.mu.Lock()
+	cached, replay := s.responses[key]
+	if replay {
+		s.replays++
+	}
+	s.mu.Unlock()
+	if replay {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(cached)
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	s.route(rec, r, body)
+
+	s.mu.Lock()
+	if key != "" && rec.Code < 400 {
+		s.responses[key] = rec.Body.Bytes()
+	}
+	lose := s.loseNext
+	s.loseNext = false
+	s.mu.Unlock()
+	if lose {
+		panic(http.ErrAbortHandler)
+	}
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+// route dispatches an API request with its decoded body
+func (s *Server) route(w http.ResponseWriter, r *http.Request, body []byte) {
+	path := r.URL.Path
+	switch {
+	case path == "/api/v1/sessions" && r.Method == "POST":
+		var session parser.Session
+		if !decode(w, body, &session) {
+			return
+		}
+		s.storeSession(&session)
+		writeJSON(w, okSession(session.ID))
+
+	case path == "/api/v1/sessions/batch" && r.Method == "POST":
+		var sessions []*parser.Session
+		if !decode(w, body, &sessions) {
+			return
+		}
+		results := make([]*client.SessionResponse, 0, len(sessions))
+		for _, session := range sessions {
+			st := s.itemStatus(session.ID)
+			if st.Succeeded() {
+				s.storeSession(session)
+			}
+			results = append(results, &client.SessionResponse{ItemStatus: st, SessionID: session.ID})
+		}
+		writeJSON(w, map[string]any{"results": results})
+
+	case path == "/api/v1/plans" && r.Method == "POST":
+		var plan parser.Plan
+		if !decode(w, body, &plan) {
+			return
+		}
+		s.storePlans(&plan)
+		writeJSON(w, client.PlanResponse{
+			ItemStatus: client.ItemStatus{Status: client.StatusOK},
+			Name:       plan.Name,
+			Source:     plan.Source,
+			Revision:   plan.Revision,
+		})
+
+	case path == "/api/v1/plans/batch" && r.Method == "POST":
+		var plans []*parser.Plan
+		if !decode(w, body, &plans) {
+			return
+		}
+		results := make([]*client.PlanResponse, 0, len(plans))
+		for _, plan := range plans {
+			st := s.itemStatus(fmt.Sprintf("%s@%d", plan.Name, plan.Revision))
+			if st.Succeeded() {
+				st = s.itemStatus(plan.Name)
+			}
+			if st.Succeeded() {
+				s.storePlans(plan)
+			}
+			results = append(results, &client.PlanResponse{ItemStatus: st, Name: plan.Name, Source: plan.Source, Revision: plan.Revision})
+		}
+		writeJSON(w, map[string]any{"results": results})
+
+	case path == "/api/v1/sessions/hashes" && r.Method == "POST":
+		var req struct {
+			Hashes []string `json:"hashes"`
+		}
+		if !decode(w, body, &req) {
+			return
+		}
+		known := []string{}
+		s.mu.Lock()
+		for _, h := range req.Hashes {
+			if s.hashes[h] {
+				known = append(known, h)
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]any{"known": known})
+
+	case strings.HasPrefix(path, "/api/v1/sessions/uploads"):
+		s.handleUpload(w, r, strings.Trim(strings.TrimPrefix(path, "/api/v1/sessions/uploads"), "/"), body)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleUpload implements the chunked upload protocol
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, rest string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// POST /api/v1/sessions/uploads
+	if rest == "" {
+		var init struct {
+			parser.Session
+			TotalRecords int `json:"total_records"`
+		}
+		if !decode(w, body, &init) {
+			return
+		}
+		s.nextID++
+		id := fmt.Sprintf("upload-%d", s.nextID)
+		header := init.Session
+		s.uploads[id] = &upload{header: &header, total: init.TotalRecords}
+		writeJSON(w, client.UploadStatus{UploadID: id, Total: init.TotalRecords})
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	up := s.uploads[id]
+	if up == nil {
+		http.Error(w, `{"error":"upload not found"}`, http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "":
+		writeJSON(w, client.UploadStatus{UploadID: id, NextOffset: len(up.records), Total: up.total})
+
+	case "chunks":
+		if s.failChunks > 0 {
+			s.failChunks--
+			http.Error(w, `{"error":"temporarily unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		var chunk client.Chunk
+		if !decode(w, body, &chunk) {
+			return
+		}
+		if s.failAt[chunk.Offset] {
+			delete(s.failAt, chunk.Offset)
+			http.Error(w, `{"error":"temporarily unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		if chunk.Offset != len(up.records) {
+			http.Error(w, fmt.Sprintf(`{"error":"expected offset %d"}`, len(up.records)), http.StatusConflict)
+			return
+		}
+		up.records = append(up.records, chunk.Records...)
+		writeJSON(w, client.UploadStatus{UploadID: id, NextOffset: len(up.records), Total: up.total})
+
+	case "complete":
+		if len(up.records) != up.total {
+			http.Error(w, fmt.Sprintf(`{"error":"received %d of %d records"}`, len(up.records), up.total), http.StatusConflict)
+			return
+		}
+		session := up.header
+		for _, rec := range up.records {
+			if err := appendRecord(session, rec); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		s.sessions[session.ID] = session
+		s.hashes[sessionHash(session)] = true
+		delete(s.uploads, id)
+		writeJSON(w, okSession(session.ID))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// okSession is the response for an accepted session
+func okSession(id string) client.SessionResponse {
+	return client.SessionResponse{ItemStatus: client.ItemStatus{Status: client.StatusOK}, SessionID: id}
+}
+
+// appendRecord adds a streamed record back onto the session
+func appendRecord(session *parser.Session, rec client.ChunkRecord) error {
+	switch rec.Type {
+	case client.RecordMessage:
+		var m parser.Message
+		if err := json.Unmarshal(rec.Data, &m); err != nil {
+			return err
+		}
+		session.Messages = append(session.Messages, m)
+	case client.RecordToolCall:
+		var t parser.ToolCallItem
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		session.ToolCalls = append(session.ToolCalls, t)
+	case client.RecordTokenUsage:
+		var u parser.TokenUsageItem
+		if err := json.Unmarshal(rec.Data, &u); err != nil {
+			return err
+		}
+		session.TokenUsage = append(session.TokenUsage, u)
+	case client.RecordCommandCall:
+		var c parser.CommandCallItem
+		if err := json.Unmarshal(rec.Data, &c); err != nil {
+			return err
+		}
+		session.CommandCalls = append(session.CommandCalls, c)
+	default:
+		return fmt.Errorf("unknown record type %q", rec.Type)
+	}
+	return nil
+}
+
+func (s *Server) storeSession(session *parser.Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	s.hashes[sessionHash(session)] = true
+}
+
+// sessionHash returns the content hash the client computes for session
+func sessionHash(session *parser.Session) string {
+	hash, _ := client.ContentHash(session)
+	return hash
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) storePlans(plans ...*parser.Plan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plans = append(s.plans, plans...)
+}
+
+// readBody decodes the request body according to Content-Encoding
+func (s *Server) readBody(r *http.Request) ([]byte, error) {
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding != "" && !strings.Contains(s.AcceptEncoding, encoding) {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	var reader io.Reader = r.Body
+	switch encoding {
+	case "":
+	case client.EncodingGzip:
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		reader = gr
+	case client.EncodingZstd:
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	return io.ReadAll(reader)
+}
+
+func decode(w http.ResponseWriter, body []byte, v any) bool {
+	if err := json.Unmarshal(body, v); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
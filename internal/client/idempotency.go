@@ -0,0 +1,96 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Upload headers. Idempotency-Key lets the server recognise a request it
+// already processed when the response was lost; X-Content-SHA256 is the
+// SHA-256 of the uncompressed JSON body.
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderContentHash    = "X-Content-SHA256"
+)
+
+// maxHashesPerRequest caps the size of a KnownSessions request
+const maxHashesPerRequest = 1000
+
+// ContentHash returns the hex SHA-256 of the JSON encoding of v, which is
+// what the server sees as the upload payload
+func ContentHash(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("marshal payload: %w", err)
+	}
+	return hashBytes(data), nil
+}
+
+// SessionKey returns the idempotency key of a session upload. It changes
+// whenever the uploaded content changes, so new activity in a session is
+// not mistaken for a duplicate.
+func SessionKey(s *parser.Session) (string, error) {
+	hash, err := ContentHash(s)
+	if err != nil {
+		return "", err
+	}
+	return sessionKey(s.ID, hash), nil
+}
+
+// sessionKey returns the idempotency key of a session with the given
+// content hash
+func sessionKey(id, hash string) string {
+	return "session:" + id + ":" + hash
+}
+
+// planKey returns the idempotency key of a plan revision upload
+func planKey(p *parser.Plan) (string, error) {
+	hash, err := ContentHash(p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("plan:%s:%d:%s", p.Key(), p.Revision, hash), nil
+}
+
+// batchKey derives the idempotency key of a batch from its item keys
+func batchKey(keys []string) string {
+	return "batch:" + hashBytes([]byte(strings.Join(keys, "\n")))
+}
+
+// KnownSessions asks the server which of the given session content hashes
+// it already stores and returns those as a set. Sessions whose hash is
+// known do not need to be uploaded again, e.g. after the state file was
+// lost or the agent was reinstalled.
+func (c *Client) KnownSessions(hashes []string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	for start := 0; start < len(hashes); start += maxHashesPerRequest {
+		end := start + maxHashesPerRequest
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		req := struct {
+			Hashes []string `json:"hashes"`
+		}{hashes[start:end]}
+		var resp struct {
+			Known []string `json:"known"`
+		}
+		if err := c.post("/api/v1/sessions/hashes", "", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, h := range resp.Known {
+			known[h] = true
+		}
+	}
+	return known, nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
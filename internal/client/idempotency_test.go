@@ -0,0 +1,106 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+func TestSessionKey(t *testing.T) {
+	base := &parser.Session{ID: "s1", TotalMessages: 2}
+	baseKey, err := SessionKey(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, _ := ContentHash(base); baseKey != "session:s1:"+hash {
+		t.Errorf("key = %q, want session ID and content hash", baseKey)
+	}
+
+	tests := []struct {
+		name    string
+		session *parser.Session
+		same    bool
+	}{
+		{"same content", &parser.Session{ID: "s1", TotalMessages: 2}, true},
+		{"new activity", &parser.Session{ID: "s1", TotalMessages: 3}, false},
+		{"other session", &parser.Session{ID: "s2", TotalMessages: 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := SessionKey(tt.session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (key == baseKey) != tt.same {
+				t.Errorf("key %q equal to %q: %v, want %v", key, baseKey, key == baseKey, tt.same)
+			}
+		})
+	}
+}
+
+func TestPlanKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		plan       *parser.Plan
+		wantPrefix string
+	}{
+		{"revision", &parser.Plan{Name: "p", Revision: 2, Content: "x"}, "plan:p:2:"},
+		{"no revision", &parser.Plan{Name: "p", Content: "x"}, "plan:p:0:"},
+		{"source", &parser.Plan{Name: "p", Source: "work", Revision: 2, Content: "x"}, "plan:work/p:2:"},
+	}
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := planKey(tt.plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, _ := ContentHash(tt.plan)
+			if key != tt.wantPrefix+hash {
+				t.Errorf("key = %q, want %q", key, tt.wantPrefix+hash)
+			}
+			if seen[key] {
+				t.Errorf("key %q not unique", key)
+			}
+			seen[key] = true
+		})
+	}
+}
+
+func TestBatchKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		same bool
+	}{
+		{"same items", []string{"k1", "k2"}, []string{"k1", "k2"}, true},
+		{"other order", []string{"k1", "k2"}, []string{"k2", "k1"}, false},
+		{"changed item", []string{"k1", "k2"}, []string{"k1", "k3"}, false},
+		{"split differently", []string{"k1\nk2"}, []string{"k1", "k2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := batchKey(tt.a), batchKey(tt.b)
+			if !strings.HasPrefix(a, "batch:") {
+				t.Errorf("key = %q", a)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("keys %q and %q equal: %v, want %v", a, b, a == b, tt.same)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	hash, err := ContentHash(map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hashBytes([]byte(`{"a":1}`)); hash != want {
+		t.Errorf("hash = %q, want %q", hash, want)
+	}
+	if _, err := ContentHash(func() {}); err == nil {
+		t.Error("hash of unencodable value succeeded")
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Default backoff bounds
+const (
+	DefaultRetryBaseDelay = 2 * time.Second
+	DefaultRetryMaxDelay  = 5 * time.Minute
+)
+
+// ErrRetryStopped is returned when a retry loop is interrupted by its stop channel
+var ErrRetryStopped = errors.New("retry stopped")
+
+// RetryPolicy retries transient failures with exponential backoff and
+// jitter, honoring Retry-After from the server
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// OnRetry is called before sleeping after a failed attempt
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// NewRetryPolicy creates a policy with the default delays
+func NewRetryPolicy(attempts int) *RetryPolicy {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &RetryPolicy{
+		Attempts:  attempts,
+		BaseDelay: DefaultRetryBaseDelay,
+		MaxDelay:  DefaultRetryMaxDelay,
+	}
+}
+
+// Delay returns how long to wait after the given failed attempt. A
+// Retry-After from the server wins; otherwise the delay doubles per attempt
+// with random jitter over its upper half.
+func (p *RetryPolicy) Delay(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, or runs out of attempts. It returns the last error.
+func (p *RetryPolicy) Do(stop <-chan struct{}, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= p.Attempts; attempt++ {
+		if err = fn(); err == nil || !IsRetryable(err) {
+			return err
+		}
+		if attempt == p.Attempts {
+			break
+		}
+
+		// A server asking for a longer pause than we are willing to block
+		// for is retried on the next sync instead
+		delay := p.Delay(attempt, err)
+		if delay > p.MaxDelay {
+			return err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		if !sleep(stop, delay) {
+			return ErrRetryStopped
+		}
+	}
+	return err
+}
+
+// Wait sleeps for the backoff delay after the given attempt. It returns
+// false if stop was closed first.
+func (p *RetryPolicy) Wait(stop <-chan struct{}, attempt int) bool {
+	return sleep(stop, p.Delay(attempt, nil))
+}
+
+// sleep waits for d unless stop is closed first
+func sleep(stop <-chan struct{}, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
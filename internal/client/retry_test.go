@@ -0,0 +1,167 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		name     string
+		attempt  int
+		err      error
+		min, max time.Duration
+	}{
+		{"first attempt", 1, nil, 500 * time.Millisecond, time.Second},
+		{"doubles", 2, nil, time.Second, 2 * time.Second},
+		{"doubles again", 3, nil, 2 * time.Second, 4 * time.Second},
+		{"capped", 10, nil, 5 * time.Second, 10 * time.Second},
+		{"retry after wins", 1, &APIError{Kind: KindRateLimited, RetryAfter: 42 * time.Second}, 42 * time.Second, 42 * time.Second},
+		{"other errors use backoff", 1, errors.New("boom"), 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				if d := p.Delay(tt.attempt, tt.err); d < tt.min || d > tt.max {
+					t.Fatalf("Delay(%d) = %v, want within [%v, %v]", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	retryable := &APIError{Kind: KindRetryable, Message: "unavailable"}
+	rejected := &APIError{Kind: KindNonRetryable, Message: "bad request"}
+	longPause := &APIError{Kind: KindRateLimited, RetryAfter: time.Hour}
+
+	tests := []struct {
+		name      string
+		errs      []error // Returned by successive calls, nil after the last
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", nil, 1, nil},
+		{"retried until success", []error{retryable, retryable}, 3, nil},
+		{"not retryable", []error{rejected}, 1, rejected},
+		{"attempts exhausted", []error{retryable, retryable, retryable, retryable}, 3, retryable},
+		{"retry after beyond max delay", []error{longPause}, 1, longPause},
+		{"plain errors are retried", []error{errors.New("reset")}, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+			var retries []int
+			p.OnRetry = func(attempt int, err error, delay time.Duration) {
+				retries = append(retries, attempt)
+			}
+
+			calls := 0
+			err := p.Do(nil, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if err != tt.wantErr {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if len(retries) != tt.wantCalls-1 {
+				t.Errorf("OnRetry called for attempts %v, want %d calls", retries, tt.wantCalls-1)
+			}
+		})
+	}
+}
+
+func TestRetryDoStopped(t *testing.T) {
+	p := &RetryPolicy{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	stop := make(chan struct{})
+	close(stop)
+
+	calls := 0
+	err := p.Do(stop, func() error {
+		calls++
+		return TransportError("send request", errors.New("refused"))
+	})
+	if err != ErrRetryStopped || calls != 1 {
+		t.Errorf("err = %v after %d calls, want %v after 1", err, calls, ErrRetryStopped)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	if p := NewRetryPolicy(0); p.Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", p.Attempts)
+	}
+	if p := NewRetryPolicy(4); p.Attempts != 4 || p.BaseDelay != DefaultRetryBaseDelay || p.MaxDelay != DefaultRetryMaxDelay {
+		t.Errorf("policy = %+v", p)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{" 5 ", 5 * time.Second},
+		{"-1", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		status     int
+		body       string
+		wantKind   ErrorKind
+		wantMsg    string
+		retryAfter string
+	}{
+		{http.StatusUnauthorized, "", KindAuth, ErrUnauthorized.Message, ""},
+		{http.StatusForbidden, `{"error":"revoked"}`, KindAuth, "revoked", ""},
+		{http.StatusTooManyRequests, `{"message":"slow down"}`, KindRateLimited, "slow down", "7"},
+		{http.StatusRequestTimeout, "", KindRetryable, "", ""},
+		{http.StatusBadGateway, "upstream down\n", KindRetryable, "upstream down", ""},
+		{http.StatusBadRequest, `{"detail":"invalid"}`, KindNonRetryable, "invalid", ""},
+		{http.StatusConflict, `{"other":1}`, KindNonRetryable, `{"other":1}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			err := ResponseError(resp, []byte(tt.body))
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, not an APIError", err)
+			}
+			if apiErr.Kind != tt.wantKind || apiErr.Message != tt.wantMsg {
+				t.Errorf("kind %v, message %q, want %v, %q", apiErr.Kind, apiErr.Message, tt.wantKind, tt.wantMsg)
+			}
+			if IsRetryable(err) != (tt.wantKind == KindRetryable || tt.wantKind == KindRateLimited) {
+				t.Errorf("IsRetryable = %v for kind %v", IsRetryable(err), tt.wantKind)
+			}
+			if tt.retryAfter != "" && apiErr.RetryAfter != 7*time.Second {
+				t.Errorf("retry after = %v", apiErr.RetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/credentials"
+)
+
+// apiKeyCommandTimeout bounds how long api_key_command may run
+const apiKeyCommandTimeout = 30 * time.Second
+
+// APIKeySource tells where an API key comes from. Only one of the fields
+// is needed; if several are set the first in declaration order wins.
+type APIKeySource struct {
+	APIKey           string `yaml:"api_key,omitempty"`            // The key itself
+	APIKeyEnv        string `yaml:"api_key_env,omitempty"`        // Environment variable holding the key
+	APIKeyFile       string `yaml:"api_key_file,omitempty"`       // File whose first line is the key
+	APIKeyCommand    string `yaml:"api_key_command,omitempty"`    // Shell command printing the key
+	APIKeyCredential string `yaml:"api_key_credential,omitempty"` // Name in the encrypted credential file
+}
+
+// IsSet reports whether any source is configured
+func (k APIKeySource) IsSet() bool {
+	return k.APIKey != "" || k.APIKeyEnv != "" || k.APIKeyFile != "" ||
+		k.APIKeyCommand != "" || k.APIKeyCredential != ""
+}
+
+// Origin describes where the key comes from, without revealing it
+func (k APIKeySource) Origin() string {
+	switch {
+	case k.APIKey != "":
+		return "api_key"
+	case k.APIKeyEnv != "":
+		return "env " + k.APIKeyEnv
+	case k.APIKeyFile != "":
+		return "file " + k.APIKeyFile
+	case k.APIKeyCommand != "":
+		return "command " + k.APIKeyCommand
+	case k.APIKeyCredential != "":
+		return "credential " + k.APIKeyCredential
+	}
+	return "not set"
+}
+
+// Resolve returns the key from its source. Credentials are read from the
+// credential file next to the config file at configPath.
+func (k APIKeySource) Resolve(configPath string) (string, error) {
+	var key string
+	switch {
+	case k.APIKey != "":
+		return k.APIKey, nil
+	case k.APIKeyEnv != "":
+		key = os.Getenv(k.APIKeyEnv)
+		if key == "" {
+			return "", fmt.Errorf("api_key_env: %s is not set", k.APIKeyEnv)
+		}
+	case k.APIKeyFile != "":
+		data, err := os.ReadFile(ExpandPath(k.APIKeyFile))
+		if err != nil {
+			return "", fmt.Errorf("api_key_file: %w", err)
+		}
+		key, _, _ = strings.Cut(string(data), "\n")
+	case k.APIKeyCommand != "":
+		out, err := runKeyCommand(k.APIKeyCommand)
+		if err != nil {
+			return "", fmt.Errorf("api_key_command: %w", err)
+		}
+		key, _, _ = strings.Cut(out, "\n")
+	case k.APIKeyCredential != "":
+		var err error
+		key, err = OpenCredentials(configPath).Get(k.APIKeyCredential)
+		if err != nil {
+			return "", fmt.Errorf("api_key_credential: %w", err)
+		}
+	default:
+		return "", nil
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("%s gave an empty key", k.Origin())
+	}
+	return key, nil
+}
+
+// runKeyCommand runs a shell command and returns its output
+func runKeyCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// ResolveAPIKeys replaces every key source with the key it refers to, so
+// sinks can use APIKey directly. configPath is the config file c was read
+// from. A resolved config must not be saved.
+func (c *Config) ResolveAPIKeys(configPath string) error {
+	key, err := c.Server.Resolve(configPath)
+	if err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	if key != "" {
+		c.Server.APIKeySource = APIKeySource{APIKey: key}
+	}
+
+	for i := range c.Sinks {
+		key, err := c.Sinks[i].Resolve(configPath)
+		if err != nil {
+			return fmt.Errorf("sink %s: %w", c.Sinks[i].Name, err)
+		}
+		if key != "" {
+			c.Sinks[i].APIKeySource = APIKeySource{APIKey: key}
+		}
+	}
+	return nil
+}
+
+// CredentialsPath returns the encrypted credential file kept next to the
+// config file at configPath
+func CredentialsPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "credentials.enc")
+}
+
+// CredentialKeyPath returns the key the credential file is encrypted
+// with. It is kept apart from the config directory, which users are more
+// likely to share or back up.
+func CredentialKeyPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "credentials.key")
+}
+
+// OpenCredentials opens the encrypted credential file of the config file
+// at configPath
+func OpenCredentials(configPath string) *credentials.Store {
+	return credentials.Open(CredentialsPath(configPath), CredentialKeyPath())
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeySourceResolve(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // Holds the credential key
+	t.Setenv("TEST_INSIGHTS_KEY", " env-key \n")
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "custom", "config.yaml")
+	if err := OpenCredentials(configPath).Set("server", "stored-key"); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("file-key\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		src        APIKeySource
+		configPath string
+		want       string
+		wantErr    string
+	}{
+		{"not set", APIKeySource{}, configPath, "", ""},
+		{"plain", APIKeySource{APIKey: "plain-key", APIKeyEnv: "TEST_INSIGHTS_KEY"}, configPath, "plain-key", ""},
+		{"env", APIKeySource{APIKeyEnv: "TEST_INSIGHTS_KEY"}, configPath, "env-key", ""},
+		{"env unset", APIKeySource{APIKeyEnv: "TEST_INSIGHTS_UNSET"}, configPath, "", "is not set"},
+		{"file", APIKeySource{APIKeyFile: keyFile}, configPath, "file-key", ""},
+		{"command", APIKeySource{APIKeyCommand: "echo command-key"}, configPath, "command-key", ""},
+		{"command empty", APIKeySource{APIKeyCommand: "true"}, configPath, "", "empty key"},
+		{"credential next to config", APIKeySource{APIKeyCredential: "server"}, configPath, "stored-key", ""},
+		{"credential of other config", APIKeySource{APIKeyCredential: "server"}, filepath.Join(dir, "config.yaml"), "", "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.src.Resolve(tt.configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialsPath(t *testing.T) {
+	tests := []struct {
+		configPath string
+		want       string
+	}{
+		{"/home/a/.config/claude-insights/config.yaml", "/home/a/.config/claude-insights/credentials.enc"},
+		{"/etc/insights/agent.yaml", "/etc/insights/credentials.enc"},
+	}
+	for _, tt := range tests {
+		if got := CredentialsPath(tt.configPath); got != filepath.FromSlash(tt.want) {
+			t.Errorf("CredentialsPath(%q) = %q, want %q", tt.configPath, got, tt.want)
+		}
+	}
+}
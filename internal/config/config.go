@@ -1,22 +1,31 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server  ServerConfig  `yaml:"server"`
-	Sharing SharingConfig `yaml:"sharing"`
-	Sync    SyncConfig    `yaml:"sync"`
-	Logging LoggingConfig `yaml:"logging"`
+	Version int            `yaml:"version"` // Schema version, see CurrentVersion
+	Server  ServerConfig   `yaml:"server"`
+	Sharing SharingConfig  `yaml:"sharing"`
+	Sinks   []SinkConfig   `yaml:"sinks,omitempty"`
+	Sources []SourceConfig `yaml:"sources,omitempty"`
+	Sync    SyncConfig     `yaml:"sync"`
+	Parsing ParsingConfig  `yaml:"parsing"`
+	Logging LoggingConfig  `yaml:"logging"`
+	Metrics MetricsConfig  `yaml:"metrics"`
 }
 
 type ServerConfig struct {
-	URL    string `yaml:"url"`
-	APIKey string `yaml:"api_key"`
+	URL          string `yaml:"url"`
+	APIKeySource `yaml:",inline"`
 }
 
 type SharingConfig struct {
@@ -25,19 +34,67 @@ type SharingConfig struct {
 	AnonymizePaths  bool     `yaml:"anonymize_paths"`
 }
 
+// Sink types
+const (
+	SinkServer    = "server"    // An insights server
+	SinkDirectory = "directory" // A local directory of JSON files
+	SinkOTLP      = "otlp"      // An OpenTelemetry collector (OTLP/HTTP)
+)
+
+// DefaultSinkName names the destination built from the server section
+// when no sinks are configured
+const DefaultSinkName = "server"
+
+// SinkConfig configures one destination. Server sinks without url or
+// any api_key setting use those of the server section; sinks without a
+// sharing section use the top-level one.
+type SinkConfig struct {
+	Name         string            `yaml:"name"`
+	Type         string            `yaml:"type"`          // server, directory, otlp
+	URL          string            `yaml:"url,omitempty"` // server, otlp
+	APIKeySource `yaml:",inline"`  // server
+	Path         string            `yaml:"path,omitempty"`    // directory
+	Headers      map[string]string `yaml:"headers,omitempty"` // otlp
+	Sharing      *SharingConfig    `yaml:"sharing,omitempty"`
+}
+
+// Target returns where the sink delivers to, for display
+func (s SinkConfig) Target() string {
+	if s.Type == SinkDirectory {
+		return s.Path
+	}
+	return s.URL
+}
+
 type SyncConfig struct {
 	Interval      int `yaml:"interval"` // seconds
 	RetryAttempts int `yaml:"retry_attempts"`
+	MaxBatchBytes int `yaml:"max_batch_bytes"` // compressed size per batch request
+}
+
+type ParsingConfig struct {
+	IdleThreshold int `yaml:"idle_threshold"` // seconds
 }
 
 type LoggingConfig struct {
-	Level string `yaml:"level"`
-	File  string `yaml:"file"`
+	Level      string `yaml:"level"`  // debug, info, warn, error
+	Format     string `yaml:"format"` // text or json
+	File       string `yaml:"file"`
+	MaxSizeMB  int    `yaml:"max_size_mb"`  // rotate the file at this size, 0 never
+	MaxAgeDays int    `yaml:"max_age_days"` // rotate the file and delete rotated files older than this, 0 never
+	MaxBackups int    `yaml:"max_backups"`  // rotated files to keep, 0 all
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Listen string `yaml:"listen"` // address such as 127.0.0.1:9464, empty disables
+	Usage  bool   `yaml:"usage"`  // also count tokens and tool calls
 }
 
 // DefaultConfig returns config with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
+		Version: CurrentVersion,
 		Server: ServerConfig{
 			URL: "https://insights.dkd.internal",
 		},
@@ -48,9 +105,17 @@ func DefaultConfig() *Config {
 		Sync: SyncConfig{
 			Interval:      300,
 			RetryAttempts: 3,
+			MaxBatchBytes: 4 * 1024 * 1024,
+		},
+		Parsing: ParsingConfig{
+			IdleThreshold: 600,
 		},
 		Logging: LoggingConfig{
-			Level: "info",
+			Level:      "info",
+			Format:     "text",
+			MaxSizeMB:  10,
+			MaxAgeDays: 30,
+			MaxBackups: 5,
 		},
 	}
 }
@@ -67,25 +132,80 @@ func StatePath() string {
 	return filepath.Join(home, ".local", "state", "claude-insights", "synced.json")
 }
 
-// ClaudeLogsPath returns the Claude Code logs directory
-func ClaudeLogsPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".claude")
+// PlanHistoryPath returns the directory holding local plan revisions
+func PlanHistoryPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "plan-history")
+}
+
+// ExpandPath replaces a leading ~ with the home directory
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[1:])
+	}
+	return path
+}
+
+// Destinations returns the configured sinks with defaults filled in.
+// Without a sinks section the server section is the only destination.
+func (c *Config) Destinations() []SinkConfig {
+	if len(c.Sinks) == 0 {
+		return []SinkConfig{{
+			Name:         DefaultSinkName,
+			Type:         SinkServer,
+			URL:          c.Server.URL,
+			APIKeySource: c.Server.APIKeySource,
+			Sharing:      &c.Sharing,
+		}}
+	}
+
+	sinks := make([]SinkConfig, len(c.Sinks))
+	for i, s := range c.Sinks {
+		if s.Type == "" {
+			s.Type = SinkServer
+		}
+		if s.Type == SinkServer {
+			if s.URL == "" {
+				s.URL = c.Server.URL
+			}
+			if !s.APIKeySource.IsSet() {
+				s.APIKeySource = c.Server.APIKeySource
+			}
+		}
+		s.Path = ExpandPath(s.Path)
+		if s.Sharing == nil {
+			s.Sharing = &c.Sharing
+		}
+		sinks[i] = s
+	}
+	return sinks
 }
 
-// Load reads config from the given path
-func Load(path string) (*Config, error) {
+// Load reads config from the given path, upgrading older versions in
+// memory. Unknown keys are returned as warnings.
+func Load(path string) (*Config, []Problem, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return decode(data)
+}
 
-	cfg := DefaultConfig()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, err
+// decode parses a config file on top of the defaults
+func decode(data []byte) (*Config, []Problem, error) {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := upgrade(doc); err != nil {
+		return nil, nil, err
 	}
 
-	return cfg, nil
+	cfg := DefaultConfig()
+	if err := doc.Decode(cfg); err != nil {
+		return nil, nil, err
+	}
+	return cfg, unknownKeys(nil, doc.Content[0], reflect.TypeOf(Config{}), ""), nil
 }
 
 // Save writes config to the given path
@@ -96,37 +216,115 @@ func (c *Config) Save(path string) error {
 		return err
 	}
 
-	data, err := yaml.Marshal(c)
-	if err != nil {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) // As in the documentation and files edited by config set
+	if err := enc.Encode(c); err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0600)
+	return os.WriteFile(path, buf.Bytes(), 0600)
 }
 
-// Validate checks if config is valid
+// Validate checks if config is valid, returning the first problem found
 func (c *Config) Validate() error {
-	if c.Server.URL == "" {
-		return ErrMissingServerURL
+	if problems := c.Problems(); len(problems) > 0 {
+		return problems[0]
 	}
-	if c.Server.APIKey == "" {
-		return ErrMissingAPIKey
+	return nil
+}
+
+// Problems returns every problem that makes the config invalid
+func (c *Config) Problems() []*ConfigError {
+	var problems []*ConfigError
+	if c.Version > CurrentVersion {
+		problems = append(problems, configError("version", "version %d is newer than this agent supports (%d)", c.Version, CurrentVersion))
 	}
-	if c.Sharing.Level != "none" && c.Sharing.Level != "metadata" && c.Sharing.Level != "full" {
-		return ErrInvalidShareLevel
+	if !validShareLevel(c.Sharing.Level) {
+		problems = append(problems, ErrInvalidShareLevel)
 	}
-	return nil
+	switch strings.ToLower(c.Logging.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		problems = append(problems, ErrInvalidLogLevel)
+	}
+	switch strings.ToLower(c.Logging.Format) {
+	case "", "text", "json":
+	default:
+		problems = append(problems, ErrInvalidLogFormat)
+	}
+	if c.Sync.Interval <= 0 {
+		problems = append(problems, ErrInvalidInterval)
+	}
+	problems = append(problems, c.sourceProblems()...)
+	if len(c.Sinks) == 0 {
+		if c.Server.URL == "" {
+			problems = append(problems, ErrMissingServerURL)
+		}
+		if !c.Server.APIKeySource.IsSet() {
+			problems = append(problems, ErrMissingAPIKey)
+		}
+		return problems
+	}
+
+	names := make(map[string]bool)
+	for i, s := range c.Destinations() {
+		key := fmt.Sprintf("sinks.%d.", i)
+		if s.Name == "" {
+			problems = append(problems, configError(key+"name", "sinks: every sink needs a name"))
+		} else if names[s.Name] {
+			problems = append(problems, configError(key+"name", "sinks: duplicate sink name %q", s.Name))
+		}
+		names[s.Name] = true
+
+		switch s.Type {
+		case SinkServer:
+			if s.URL == "" {
+				problems = append(problems, configError(key+"url", "sink %s: url is required", s.Name))
+			}
+			if !s.APIKeySource.IsSet() {
+				problems = append(problems, configError(key+"api_key", "sink %s: api_key or one of api_key_env, api_key_file, api_key_command, api_key_credential is required", s.Name))
+			}
+		case SinkDirectory:
+			if s.Path == "" {
+				problems = append(problems, configError(key+"path", "sink %s: path is required", s.Name))
+			}
+		case SinkOTLP:
+			if s.URL == "" {
+				problems = append(problems, configError(key+"url", "sink %s: url is required", s.Name))
+			}
+		default:
+			problems = append(problems, configError(key+"type", "sink %s: unknown type %q", s.Name, s.Type))
+		}
+		// Inherited sharing settings are checked at the top level
+		if c.Sinks[i].Sharing != nil && !validShareLevel(s.Sharing.Level) {
+			problems = append(problems, configError(key+"sharing.level", "sink %s: sharing.level must be none, metadata, or full", s.Name))
+		}
+	}
+	return problems
+}
+
+func validShareLevel(level string) bool {
+	return level == "none" || level == "metadata" || level == "full"
 }
 
 // Errors
 var (
-	ErrMissingServerURL  = &ConfigError{"server.url is required"}
-	ErrMissingAPIKey     = &ConfigError{"server.api_key is required"}
-	ErrInvalidShareLevel = &ConfigError{"sharing.level must be none, metadata, or full"}
+	ErrMissingServerURL  = configError("server.url", "server.url is required")
+	ErrMissingAPIKey     = configError("server.api_key", "server.api_key or one of api_key_env, api_key_file, api_key_command, api_key_credential is required")
+	ErrInvalidShareLevel = configError("sharing.level", "sharing.level must be none, metadata, or full")
+	ErrInvalidLogLevel   = configError("logging.level", "logging.level must be debug, info, warn, or error")
+	ErrInvalidLogFormat  = configError("logging.format", "logging.format must be text or json")
+	ErrInvalidInterval   = configError("sync.interval", "sync.interval must be a positive number of seconds")
 )
 
 type ConfigError struct {
 	Message string
+	Key     string // Dotted key of the offending setting, list items by index
+}
+
+func configError(key, format string, args ...any) *ConfigError {
+	return &ConfigError{Message: fmt.Sprintf(format, args...), Key: key}
 }
 
 func (e *ConfigError) Error() string {
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a config file edited as a YAML node tree, so settings can
+// be changed without losing the user's comments
+type Document struct {
+	path string
+	doc  *yaml.Node
+}
+
+// OpenDocument reads the config file at path for editing. A missing file
+// is an empty document; an older one is upgraded to the current version.
+func OpenDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := upgrade(doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Document{path: path, doc: doc}, nil
+}
+
+// Config decodes the document on top of the defaults
+func (d *Document) Config() (*Config, error) {
+	cfg := DefaultConfig()
+	if err := d.doc.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", d.path, err)
+	}
+	return cfg, nil
+}
+
+// Set parses value for the setting with the given dotted key, as
+// Field.Set does, and writes it to the document
+func (d *Document) Set(key, value string) error {
+	f, ok := DefaultConfig().Field(key)
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err := f.Set(value); err != nil {
+		return err
+	}
+
+	var node yaml.Node
+	if err := node.Encode(f.value.Interface()); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	m := d.doc.Content[0]
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		_, v := mappingEntry(m, part)
+		if v == nil {
+			v = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, v)
+		} else if v.Kind != yaml.MappingNode {
+			// An empty section such as "sharing:" is null
+			*v = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: v.HeadComment, LineComment: v.LineComment}
+		}
+		m = v
+	}
+
+	last := parts[len(parts)-1]
+	if _, v := mappingEntry(m, last); v != nil {
+		node.HeadComment, node.LineComment, node.FootComment = v.HeadComment, v.LineComment, v.FootComment
+		*v = node
+		return nil
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, &node)
+	return nil
+}
+
+// Unset removes the setting with the given dotted key from the document,
+// so it takes its default, and reports whether it was present
+func (d *Document) Unset(key string) (bool, error) {
+	if _, ok := DefaultConfig().Field(key); !ok {
+		return false, fmt.Errorf("unknown setting %q", key)
+	}
+
+	m := d.doc.Content[0]
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		_, v := mappingEntry(m, part)
+		if v == nil || v.Kind != yaml.MappingNode {
+			return false, nil
+		}
+		m = v
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == parts[len(parts)-1] {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Save writes the document back to its file
+func (d *Document) Save() error {
+	return writeDocument(d.path, d.doc)
+}
+
+// writeDocument writes a YAML document to path with owner-only
+// permissions through a temporary file
+func writeDocument(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
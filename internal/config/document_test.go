@@ -0,0 +1,202 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// commentedConfig is a config file as a user might keep it
+const commentedConfig = `# Agent config
+version: 1
+server:
+  url: https://x # Our server
+  api_key_env: INSIGHTS_KEY
+# What to share
+sharing:
+  level: metadata # Keep it small
+  exclude_projects:
+    - "**/personal/**"
+`
+
+func TestDocumentSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		value   string
+		want    string // Complete file afterwards
+		wantErr string
+	}{
+		{
+			name:    "replace keeps comments",
+			content: commentedConfig,
+			key:     "sharing.level",
+			value:   "full",
+			want:    strings.Replace(commentedConfig, "level: metadata", "level: full", 1),
+		},
+		{
+			name:    "replace list",
+			content: commentedConfig,
+			key:     "sharing.exclude_projects",
+			value:   "**/a/**,**/b/**",
+			want:    strings.Replace(commentedConfig, "    - \"**/personal/**\"\n", "    - '**/a/**'\n    - '**/b/**'\n", 1),
+		},
+		{
+			name:    "add to existing section",
+			content: commentedConfig,
+			key:     "sharing.anonymize_paths",
+			value:   "false",
+			want:    commentedConfig + "  anonymize_paths: false\n",
+		},
+		{
+			name:    "add section",
+			content: commentedConfig,
+			key:     "sync.interval",
+			value:   "60",
+			want:    commentedConfig + "sync:\n  interval: 60\n",
+		},
+		{
+			name:    "fill empty section",
+			content: "version: 1\nsync: # Defaults for now\n",
+			key:     "sync.interval",
+			value:   "60",
+			want:    "version: 1\nsync: # Defaults for now\n  interval: 60\n",
+		},
+		{
+			name:  "missing file",
+			key:   "sharing.level",
+			value: "none",
+			want:  "version: 1\nsharing:\n  level: none\n",
+		},
+		{
+			name:    "unknown key",
+			content: commentedConfig,
+			key:     "sharing.levle",
+			value:   "none",
+			wantErr: `unknown setting "sharing.levle"`,
+		},
+		{
+			name:    "invalid value",
+			content: commentedConfig,
+			key:     "sync.interval",
+			value:   "soon",
+			wantErr: "soon",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := configFile(t, tt.content)
+			doc, err := OpenDocument(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = doc.Set(tt.key, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := doc.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != tt.want {
+				t.Errorf("file =\n%s\nwant\n%s", data, tt.want)
+			}
+
+			cfg, err := doc.Config()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, _ := cfg.Field(tt.key)
+			if f.String() != tt.value {
+				t.Errorf("%s = %q, want %q", tt.key, f.String(), tt.value)
+			}
+		})
+	}
+}
+
+func TestDocumentUnset(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		wantFound bool
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "setting",
+			key:       "sharing.level",
+			wantFound: true,
+			want:      strings.Replace(commentedConfig, "  level: metadata # Keep it small\n", "", 1),
+		},
+		{
+			name:      "list",
+			key:       "sharing.exclude_projects",
+			wantFound: true,
+			want:      strings.Replace(commentedConfig, "  exclude_projects:\n    - \"**/personal/**\"\n", "", 1),
+		},
+		{
+			name: "not in file",
+			key:  "sharing.anonymize_paths",
+			want: commentedConfig,
+		},
+		{
+			name: "section not in file",
+			key:  "sync.interval",
+			want: commentedConfig,
+		},
+		{
+			name:    "unknown key",
+			key:     "sharing.levle",
+			want:    commentedConfig,
+			wantErr: `unknown setting "sharing.levle"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := configFile(t, commentedConfig)
+			doc, err := OpenDocument(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found, err := doc.Unset(tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("found = %v, want %v", found, tt.wantFound)
+			}
+			if err := doc.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := os.ReadFile(path); string(data) != tt.want {
+				t.Errorf("file =\n%s\nwant\n%s", data, tt.want)
+			}
+		})
+	}
+}
+
+// configFile writes content to a config file, unless it is empty,
+// and returns its path
+func configFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
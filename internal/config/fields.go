@@ -0,0 +1,116 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Field is a single setting addressed by its dotted YAML key, such as
+// sharing.level. Lists of sinks are a single field.
+type Field struct {
+	Key   string
+	value reflect.Value
+}
+
+// Fields returns every setting of the config in declaration order
+func (c *Config) Fields() []Field {
+	return appendFields(nil, "", reflect.ValueOf(c).Elem())
+}
+
+// Field returns the setting with the given dotted key
+func (c *Config) Field(key string) (Field, bool) {
+	for _, f := range c.Fields() {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func appendFields(fields []Field, prefix string, v reflect.Value) []Field {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if t.Field(i).Anonymous && opts == "inline" {
+			fields = appendFields(fields, prefix, v.Field(i))
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		if fv := v.Field(i); fv.Kind() == reflect.Struct {
+			fields = appendFields(fields, key+".", fv)
+		} else {
+			fields = append(fields, Field{Key: key, value: fv})
+		}
+	}
+	return fields
+}
+
+// String formats the value the way Set accepts it: lists of strings
+// comma-separated, other lists and maps as JSON
+func (f Field) String() string {
+	switch f.value.Kind() {
+	case reflect.String:
+		return f.value.String()
+	case reflect.Int:
+		return strconv.FormatInt(f.value.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(f.value.Bool())
+	case reflect.Slice:
+		if f.value.Type().Elem().Kind() == reflect.String {
+			return strings.Join(f.value.Interface().([]string), ",")
+		}
+	}
+	data, err := json.Marshal(f.value.Interface())
+	if err != nil {
+		return fmt.Sprint(f.value.Interface())
+	}
+	return string(data)
+}
+
+// Set parses s into the field. Lists of strings are comma-separated;
+// other lists and maps are YAML or JSON.
+func (f Field) Set(s string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.Key, s)
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not true or false", f.Key, s)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		if f.value.Type().Elem().Kind() == reflect.String {
+			var items []string
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			f.value.Set(reflect.ValueOf(items))
+			return nil
+		}
+		fallthrough
+	default:
+		ptr := reflect.New(f.value.Type())
+		if err := yaml.Unmarshal([]byte(s), ptr.Interface()); err != nil {
+			return fmt.Errorf("%s: %w", f.Key, err)
+		}
+		f.value.Set(ptr.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are resolved in this order, each overriding the previous:
+//
+//  1. built-in defaults
+//  2. the config file: --config, else $CLAUDE_INSIGHTS_CONFIG, else
+//     ~/.config/claude-insights/config.yaml
+//  3. environment variables: CLAUDE_INSIGHTS_ followed by the dotted key
+//     in upper case with dots as underscores, e.g. sharing.level is
+//     CLAUDE_INSIGHTS_SHARING_LEVEL
+//  4. command line flags, in the order given
+
+// EnvPrefix starts the environment variables that override settings
+const EnvPrefix = "CLAUDE_INSIGHTS_"
+
+// EnvConfigPath names the environment variable selecting the config file
+const EnvConfigPath = EnvPrefix + "CONFIG"
+
+// Kinds of setting origins, from lowest to highest precedence
+const (
+	OriginDefault = "default"
+	OriginFile    = "file"
+	OriginEnv     = "env"
+	OriginFlag    = "flag"
+)
+
+// Origin tells where the effective value of a setting came from
+type Origin struct {
+	Kind string
+	Name string // File path, environment variable or flag
+}
+
+func (o Origin) String() string {
+	if o.Name == "" {
+		return o.Kind
+	}
+	return o.Kind + " " + o.Name
+}
+
+// Override is a setting given on the command line
+type Override struct {
+	Key   string
+	Value string
+	Flag  string // The flag that set it, for reporting
+}
+
+// Resolved is the effective config with the origin of every setting
+type Resolved struct {
+	*Config
+	Path      string            // Config file consulted
+	FileFound bool              // Whether the config file exists
+	Origins   map[string]Origin // By dotted key
+	Warnings  []Problem         // Unknown keys in the config file
+}
+
+// EnvName returns the environment variable overriding a dotted key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Resolve builds the effective config from defaults, the config file at
+// path (see the precedence above if empty), the environment given as
+// KEY=value pairs and command line overrides. A missing config file is
+// not an error.
+func Resolve(path string, environ []string, overrides []Override) (*Resolved, error) {
+	env := envSettings(environ)
+	if path == "" {
+		path = env[EnvConfigPath]
+	}
+	if path == "" {
+		path = ConfigPath()
+	}
+	path = ExpandPath(path)
+
+	r := newResolved(path)
+	fields := r.Config.Fields()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		r.FileFound = true
+		cfg, warnings, err := decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		*r.Config, r.Warnings = *cfg, warnings
+		var raw map[string]any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		present := flattenKeys(nil, "", raw)
+		for _, f := range fields {
+			if present[f.Key] {
+				r.Origins[f.Key] = Origin{Kind: OriginFile, Name: path}
+			}
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	if err := r.override(env, overrides); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Build returns the defaults with the environment and command line
+// overrides applied, ignoring any config file
+func Build(environ []string, overrides []Override) (*Resolved, error) {
+	r := newResolved("")
+	if err := r.override(envSettings(environ), overrides); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// envSettings picks the variables starting with EnvPrefix from KEY=value
+// pairs
+func envSettings(environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+func newResolved(path string) *Resolved {
+	r := &Resolved{Config: DefaultConfig(), Path: path, Origins: make(map[string]Origin)}
+	for _, f := range r.Config.Fields() {
+		r.Origins[f.Key] = Origin{Kind: OriginDefault}
+	}
+	return r
+}
+
+// override applies environment variables, then command line overrides
+func (r *Resolved) override(env map[string]string, overrides []Override) error {
+	for _, f := range r.Config.Fields() {
+		name := EnvName(f.Key)
+		v, ok := env[name]
+		if !ok {
+			continue
+		}
+		if err := f.Set(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		r.Origins[f.Key] = Origin{Kind: OriginEnv, Name: name}
+	}
+
+	for _, o := range overrides {
+		f, ok := r.Config.Field(o.Key)
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", o.Flag, o.Key)
+		}
+		if err := f.Set(o.Value); err != nil {
+			return fmt.Errorf("%s: %w", o.Flag, err)
+		}
+		r.Origins[f.Key] = Origin{Kind: OriginFlag, Name: o.Flag}
+	}
+	return nil
+}
+
+// flattenKeys records the dotted keys of a decoded YAML document. Lists
+// are leaves.
+func flattenKeys(keys map[string]bool, prefix string, m map[string]any) map[string]bool {
+	if keys == nil {
+		keys = make(map[string]bool)
+	}
+	for k, v := range m {
+		key := prefix + k
+		keys[key] = true
+		if sub, ok := v.(map[string]any); ok {
+			flattenKeys(keys, key+".", sub)
+		}
+	}
+	return keys
+}
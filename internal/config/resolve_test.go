@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	const fileContent = "version: 1\nsharing:\n  level: none\nsync:\n  interval: 60\n"
+
+	tests := []struct {
+		name       string
+		file       string // Config file content, empty for no file
+		environ    []string
+		overrides  []Override
+		wantLevel  string
+		wantOrigin string
+		wantFound  bool
+	}{
+		{"defaults", "", nil, nil, "metadata", OriginDefault, false},
+		{"file over defaults", fileContent, nil, nil, "none", OriginFile, true},
+		{"env over file", fileContent, []string{"CLAUDE_INSIGHTS_SHARING_LEVEL=full"}, nil, "full", OriginEnv, true},
+		{"env without file", "", []string{"CLAUDE_INSIGHTS_SHARING_LEVEL=full"}, nil, "full", OriginEnv, false},
+		{"flag over env", fileContent, []string{"CLAUDE_INSIGHTS_SHARING_LEVEL=full"},
+			[]Override{{Key: "sharing.level", Value: "metadata", Flag: "--sharing-level"}}, "metadata", OriginFlag, true},
+		{"last flag wins", "", nil,
+			[]Override{{Key: "sharing.level", Value: "full", Flag: "--set"}, {Key: "sharing.level", Value: "none", Flag: "--sharing-level"}}, "none", OriginFlag, false},
+		{"unrelated env", fileContent, []string{"CLAUDE_INSIGHTS_UNKNOWN=x", "SHARING_LEVEL=full"}, nil, "none", OriginFile, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.yaml")
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+			r, err := Resolve(path, tt.environ, tt.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Sharing.Level != tt.wantLevel {
+				t.Errorf("sharing.level = %q, want %q", r.Sharing.Level, tt.wantLevel)
+			}
+			if got := r.Origins["sharing.level"].Kind; got != tt.wantOrigin {
+				t.Errorf("origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if r.FileFound != tt.wantFound {
+				t.Errorf("file found = %v, want %v", r.FileFound, tt.wantFound)
+			}
+
+			// Settings not overridden keep the file value or the default
+			wantInterval, wantIntervalOrigin := 300, OriginDefault
+			if tt.file != "" {
+				wantInterval, wantIntervalOrigin = 60, OriginFile
+			}
+			if r.Sync.Interval != wantInterval || r.Origins["sync.interval"].Kind != wantIntervalOrigin {
+				t.Errorf("sync.interval = %d from %s, want %d from %s", r.Sync.Interval, r.Origins["sync.interval"], wantInterval, wantIntervalOrigin)
+			}
+		})
+	}
+}
+
+func TestResolveConfigPath(t *testing.T) {
+	envFile := writeConfig(t, "version: 1\nsharing:\n  level: none\n")
+	flagFile := writeConfig(t, "version: 1\nsharing:\n  level: full\n")
+
+	tests := []struct {
+		name     string
+		path     string
+		environ  []string
+		wantPath string
+	}{
+		{"flag path over env", flagFile, []string{EnvConfigPath + "=" + envFile}, flagFile},
+		{"env path", "", []string{EnvConfigPath + "=" + envFile}, envFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Resolve(tt.path, tt.environ, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q", r.Path, tt.wantPath)
+			}
+			if got := r.Origins["sharing.level"]; got.Kind != OriginFile || got.Name != tt.wantPath {
+				t.Errorf("origin = %v, want file %s", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		environ   []string
+		overrides []Override
+		wantErr   string
+	}{
+		{"invalid env value", "", []string{"CLAUDE_INSIGHTS_SYNC_INTERVAL=soon"}, nil, "CLAUDE_INSIGHTS_SYNC_INTERVAL"},
+		{"invalid flag value", "", nil, []Override{{Key: "sync.interval", Value: "soon", Flag: "--set"}}, "--set"},
+		{"unknown flag key", "", nil, []Override{{Key: "sync.intervall", Value: "1", Flag: "--set"}}, `unknown setting "sync.intervall"`},
+		{"invalid file", "sharing: [", nil, nil, "config.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.yaml")
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+			}
+			_, err := Resolve(path, tt.environ, tt.overrides)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	t.Setenv(EnvConfigPath, writeConfig(t, "version: 1\nsharing:\n  level: none\n"))
+
+	tests := []struct {
+		name       string
+		environ    []string
+		overrides  []Override
+		wantLevel  string
+		wantOrigin string
+	}{
+		{"defaults, ignoring the file", os.Environ(), nil, "metadata", OriginDefault},
+		{"env", []string{"CLAUDE_INSIGHTS_SHARING_LEVEL=full"}, nil, "full", OriginEnv},
+		{"flag over env", []string{"CLAUDE_INSIGHTS_SHARING_LEVEL=full"}, []Override{{Key: "sharing.level", Value: "none", Flag: "--sharing-level"}}, "none", OriginFlag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Build(tt.environ, tt.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Sharing.Level != tt.wantLevel || r.Origins["sharing.level"].Kind != tt.wantOrigin {
+				t.Errorf("sharing.level = %q from %s, want %q from %s", r.Sharing.Level, r.Origins["sharing.level"], tt.wantLevel, tt.wantOrigin)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config schema version this agent writes. Configs
+// without a version field are version 0.
+const CurrentVersion = 1
+
+// migrations upgrade a config document one version at a time: the one at
+// index i turns version i into version i+1, so there must be
+// CurrentVersion of them. They work on the YAML node tree to keep the
+// user's comments and layout.
+var migrations = []func(doc *yaml.Node) error{
+	// 0 to 1: the version field was introduced, nothing else changed
+	func(doc *yaml.Node) error { return nil },
+}
+
+// Migration describes an upgrade of a config file
+type Migration struct {
+	From, To int
+	Backup   string // Copy of the file before the upgrade
+}
+
+// Migrate upgrades the config file at path to the current version in
+// place, keeping a copy of the old file next to it. It returns nil if the
+// file is missing or already current.
+func Migrate(path string) (*Migration, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	from, err := upgrade(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if from >= CurrentVersion {
+		return nil, nil
+	}
+
+	m := &Migration{From: from, To: CurrentVersion, Backup: fmt.Sprintf("%s.v%d.bak", path, from)}
+	if err := os.WriteFile(m.Backup, data, 0600); err != nil {
+		return nil, fmt.Errorf("back up config: %w", err)
+	}
+	if err := writeDocument(path, doc); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseDocument parses a config file into a document holding a mapping.
+// An empty file is an empty mapping.
+func parseDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of settings", doc.Content[0].Line)
+	}
+	return &doc, nil
+}
+
+// upgrade applies the migrations a document needs in memory and returns
+// the version it had. Documents newer than CurrentVersion are left alone
+// for Validate to reject.
+func upgrade(doc *yaml.Node) (int, error) {
+	from, err := documentVersion(doc)
+	if err != nil || from >= CurrentVersion {
+		return from, err
+	}
+	for v := from; v < CurrentVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return from, fmt.Errorf("upgrade from version %d: %w", v, err)
+		}
+	}
+	setVersion(doc, CurrentVersion)
+	return from, nil
+}
+
+// documentVersion reads the version field of a document, 0 if missing
+func documentVersion(doc *yaml.Node) (int, error) {
+	_, value := mappingEntry(doc.Content[0], "version")
+	if value == nil {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(value.Value)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("line %d: version must be a whole number", value.Line)
+	}
+	return v, nil
+}
+
+// setVersion sets the version field of a document, adding it at the top
+func setVersion(doc *yaml.Node, version int) {
+	m := doc.Content[0]
+	if _, value := mappingEntry(m, "version"); value != nil {
+		value.Value, value.Tag = strconv.Itoa(version), "!!int"
+		return
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)}
+	if len(m.Content) > 0 {
+		// Keep a comment heading the file above the new field
+		key.HeadComment, m.Content[0].HeadComment = m.Content[0].HeadComment, ""
+	}
+	m.Content = append([]*yaml.Node{key, value}, m.Content...)
+}
+
+// mappingEntry returns the key and value nodes of a mapping entry
+func mappingEntry(m *yaml.Node, name string) (key, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == name {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// Problem is an issue found in a config file
+type Problem struct {
+	Line    int // 0 if not tied to a line
+	Message string
+	Warning bool // The config still works, but likely not as intended
+}
+
+func (p Problem) String() string {
+	kind := "error"
+	if p.Warning {
+		kind = "warning"
+	}
+	if p.Line == 0 {
+		return kind + ": " + p.Message
+	}
+	return fmt.Sprintf("line %d: %s: %s", p.Line, kind, p.Message)
+}
+
+// linePrefix matches the position yaml.v3 puts in front of its messages
+var linePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// yamlProblem turns a YAML error message into a problem with its line
+func yamlProblem(msg string) Problem {
+	if m := linePrefix.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return Problem{Line: line, Message: msg[len(m[0]):]}
+	}
+	return Problem{Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// Check reports every problem of the config file at path, ordered by
+// line: syntax and type errors, unknown keys, an outdated version,
+// invalid settings and source share levels that cannot take effect. The environment and flags are not considered.
+func Check(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return []Problem{yamlProblem(err.Error())}, nil
+	}
+
+	var problems []Problem
+	from, err := upgrade(doc)
+	switch {
+	case err != nil:
+		problems = append(problems, yamlProblem(err.Error()))
+	case from < CurrentVersion:
+		line := 0
+		if key, _ := mappingEntry(doc.Content[0], "version"); key != nil {
+			line = key.Line
+		}
+		problems = append(problems, Problem{
+			Line:    line,
+			Message: fmt.Sprintf("config is version %d; the agent upgrades it to version %d when it next loads it", from, CurrentVersion),
+			Warning: true,
+		})
+	}
+	problems = append(problems, unknownKeys(nil, doc.Content[0], reflect.TypeOf(Config{}), "")...)
+
+	cfg := DefaultConfig()
+	if err := doc.Decode(cfg); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, err
+		}
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, yamlProblem(msg))
+		}
+	}
+	for _, e := range cfg.Problems() {
+		problems = append(problems, Problem{Line: keyLine(doc.Content[0], e.Key), Message: e.Message})
+	}
+	for _, e := range cfg.sourceWarnings() {
+		problems = append(problems, Problem{Line: keyLine(doc.Content[0], e.Key), Message: e.Message, Warning: true})
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Line, problems[j].Line
+		return a != 0 && (b == 0 || a < b)
+	})
+	return problems, nil
+}
+
+// unknownKeys reports keys of a mapping node that do not correspond to
+// fields of t, descending into nested settings and lists
+func unknownKeys(problems []Problem, node *yaml.Node, t reflect.Type, prefix string) []Problem {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			problems = unknownKeys(problems, item, t.Elem(), fmt.Sprintf("%s%d.", prefix, i))
+		}
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(nil, t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %s%s", prefix, key.Value)
+				if s := suggest(key.Value, fields); s != "" {
+					msg += fmt.Sprintf(" (did you mean %s?)", s)
+				}
+				problems = append(problems, Problem{Line: key.Line, Message: msg, Warning: true})
+				continue
+			}
+			problems = unknownKeys(problems, value, ft, prefix+key.Value+".")
+		}
+	}
+	return problems
+}
+
+// yamlFields maps the YAML names of a struct's fields, including inlined
+// ones, to their types
+func yamlFields(fields map[string]reflect.Type, t reflect.Type) map[string]reflect.Type {
+	if fields == nil {
+		fields = make(map[string]reflect.Type)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch {
+		case f.Anonymous && opts == "inline":
+			yamlFields(fields, f.Type)
+		case name != "" && name != "-":
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
+
+// suggest returns the known name closest to a misspelled one, if any is
+// close enough
+func suggest(name string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for known := range fields {
+		if d := editDistance(name, known); d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// keyLine returns the line of a dotted key in a mapping, list items by
+// index, or of its closest ancestor present in the file. It returns 0 if
+// not even the top-level key is present.
+func keyLine(m *yaml.Node, key string) int {
+	line := 0
+	node := m
+	for _, part := range strings.Split(key, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			k, v := mappingEntry(node, part)
+			if k == nil {
+				return line
+			}
+			line, node = k.Line, v
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(part)
+			if err != nil || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+		default:
+			return line
+		}
+	}
+	return line
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string // Empty for no file
+		want      *Migration
+		wantFile  string // Content afterwards, same as before if empty
+		wantError string
+	}{
+		{
+			name: "missing file",
+		},
+		{
+			name:    "current",
+			content: "version: 1\nsharing:\n  level: full\n",
+		},
+		{
+			name:    "newer version left for Validate",
+			content: "version: 2\n",
+		},
+		{
+			name:     "unversioned",
+			content:  "# Agent config\nserver:\n  url: https://x # Our server\n# Share less\nsharing:\n  level: none\n",
+			want:     &Migration{From: 0, To: 1},
+			wantFile: "# Agent config\nversion: 1\nserver:\n  url: https://x # Our server\n# Share less\nsharing:\n  level: none\n",
+		},
+		{
+			name:     "version 0",
+			content:  "version: 0\nsync:\n  interval: 60\n",
+			want:     &Migration{From: 0, To: 1},
+			wantFile: "version: 1\nsync:\n  interval: 60\n",
+		},
+		{
+			name:     "empty file",
+			content:  "\n",
+			want:     &Migration{From: 0, To: 1},
+			wantFile: "version: 1\n",
+		},
+		{
+			name:      "invalid version",
+			content:   "version: latest\n",
+			wantError: "line 1: version must be a whole number",
+		},
+		{
+			name:      "not a mapping",
+			content:   "- server\n",
+			wantError: "expected a mapping of settings",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := Migrate(path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantError)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("migration = %+v, want none", got)
+				}
+				if backups, _ := filepath.Glob(path + ".*"); len(backups) > 0 {
+					t.Errorf("backups written: %v", backups)
+				}
+			} else {
+				if got == nil || got.From != tt.want.From || got.To != tt.want.To {
+					t.Fatalf("migration = %+v, want %+v", got, tt.want)
+				}
+				backup, err := os.ReadFile(got.Backup)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(backup) != tt.content {
+					t.Errorf("backup = %q, want the original %q", backup, tt.content)
+				}
+				if got.Backup != path+".v0.bak" {
+					t.Errorf("backup path = %q", got.Backup)
+				}
+			}
+
+			if tt.content == "" {
+				return
+			}
+			wantFile := tt.wantFile
+			if wantFile == "" {
+				wantFile = tt.content
+			}
+			if data, _ := os.ReadFile(path); string(data) != wantFile {
+				t.Errorf("file = %q, want %q", data, wantFile)
+			}
+		})
+	}
+}
+
+func TestMigrateThenLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("sharing:\n  level: none\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(path); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Resolve(path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version != CurrentVersion || r.Sharing.Level != "none" || len(r.Warnings) != 0 {
+		t.Errorf("loaded version %d, level %q, warnings %v", r.Version, r.Sharing.Level, r.Warnings)
+	}
+	if again, err := Migrate(path); again != nil || err != nil {
+		t.Errorf("second migration = %+v, %v, want none", again, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	type want struct {
+		line    int
+		message string
+		warning bool
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []want // In order
+	}{
+		{
+			name:    "valid",
+			content: "version: 1\nserver:\n  api_key_env: KEY\nsharing:\n  level: full\n",
+		},
+		{
+			name:    "unknown keys with suggestions",
+			content: "version: 1\nserver:\n  url: https://x\n  api_kye: k\nsinks:\n  - name: a\n    type: directory\n    path: /tmp\n    colour: red\n",
+			want: []want{
+				{4, "unknown key server.api_kye (did you mean api_key?)", true},
+				{9, "unknown key sinks.0.colour", true},
+			},
+		},
+		{
+			name:    "outdated version",
+			content: "version: 0\nserver:\n  api_key_env: KEY\n",
+			want:    []want{{1, "config is version 0; the agent upgrades it to version 1", true}},
+		},
+		{
+			name:    "unversioned",
+			content: "server:\n  api_key_env: KEY\n",
+			want:    []want{{0, "config is version 0", true}},
+		},
+		{
+			name:    "invalid values ordered by line",
+			content: "version: 1\nsync:\n  interval: soon\nsharing:\n  level: bogus\n",
+			want: []want{
+				{3, "cannot unmarshal !!str `soon` into int", false},
+				{5, "sharing.level must be none, metadata, or full", false},
+				{0, "server.api_key or one of api_key_env", false},
+			},
+		},
+		{
+			name:    "missing sink path at the sink",
+			content: "version: 1\nsinks:\n  - name: a\n    type: directory\n    pth: /tmp\n",
+			want: []want{
+				{3, "sink a: path is required", false},
+				{5, "unknown key sinks.0.pth (did you mean path?)", true},
+			},
+		},
+		{
+			name:    "source cannot loosen a sink",
+			content: "version: 1\nsinks:\n  - name: a\n    type: directory\n    path: /tmp\n    sharing:\n      level: metadata\nsources:\n  - label: work\n    path: /w\n    share_level: full\n  - label: home\n    path: /h\n    share_level: none\n",
+			want:    []want{{11, "source work: share_level full cannot loosen sink a, which stays at metadata", true}},
+		},
+		{
+			name:    "syntax error",
+			content: "version: 1\nsharing:\n\tlevel: full\n",
+			want:    []want{{3, "found character that cannot start any token", false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			problems, err := Check(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != len(tt.want) {
+				t.Fatalf("problems = %v, want %d", problems, len(tt.want))
+			}
+			for i, p := range problems {
+				w := tt.want[i]
+				if p.Line != w.line || !strings.Contains(p.Message, w.message) || p.Warning != w.warning {
+					t.Errorf("problem %d = %v, want line %d, %q, warning %v", i, p, w.line, w.message, w.warning)
+				}
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	fields := yamlFields(nil, reflect.TypeOf(ServerConfig{}))
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"api_kye", "api_key"},
+		{"ur", "url"},
+		{"api_key_enviroment", ""},
+		{"colour", ""},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.name, fields); got != tt.want {
+			t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeyLine(t *testing.T) {
+	doc, err := parseDocument([]byte("version: 1\nsharing:\n  level: full\nsinks:\n  - name: a\n    type: directory\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"version", 1},
+		{"sharing.level", 3},
+		{"sharing.exclude_projects", 2},
+		{"sinks.0.type", 6},
+		{"sinks.0.path", 5},
+		{"sinks.3.path", 4},
+		{"sync.interval", 0},
+	}
+	for _, tt := range tests {
+		if got := keyLine(doc.Content[0], tt.key); got != tt.want {
+			t.Errorf("keyLine(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
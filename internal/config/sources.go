@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// EnvClaudeConfigDir is the variable Claude Code reads its data directory
+// from
+const EnvClaudeConfigDir = "CLAUDE_CONFIG_DIR"
+
+// DefaultSourceLabel labels the Claude data directory used when no
+// sources are configured
+const DefaultSourceLabel = "default"
+
+// SourceConfig is a Claude Code data directory to read sessions and
+// plans from. A share level set here applies to its sessions on every
+// sink, but can only tighten a sink's level, never loosen it.
+type SourceConfig struct {
+	Label      string `yaml:"label"`
+	Path       string `yaml:"path"`
+	ShareLevel string `yaml:"share_level,omitempty"` // none, metadata, full
+}
+
+// ClaudeSources returns the configured data directories with paths
+// expanded. Without a sources section the only source is
+// $CLAUDE_CONFIG_DIR, or ~/.claude if that is unset.
+func (c *Config) ClaudeSources() []SourceConfig {
+	if len(c.Sources) == 0 {
+		return []SourceConfig{{Label: DefaultSourceLabel, Path: ClaudeLogsPath()}}
+	}
+
+	sources := make([]SourceConfig, len(c.Sources))
+	for i, s := range c.Sources {
+		s.Path = ExpandPath(s.Path)
+		if s.Label == "" {
+			s.Label = filepath.Base(s.Path)
+		}
+		sources[i] = s
+	}
+	return sources
+}
+
+// sourceProblems checks that sources have distinct labels and paths
+func (c *Config) sourceProblems() []*ConfigError {
+	var problems []*ConfigError
+	labels := make(map[string]bool)
+	paths := make(map[string]bool)
+	for i, s := range c.ClaudeSources() {
+		key := fmt.Sprintf("sources.%d.", i)
+		if s.Path == "" {
+			problems = append(problems, configError(key+"path", "source %s: path is required", s.Label))
+		}
+		if labels[s.Label] {
+			problems = append(problems, configError(key+"label", "sources: duplicate label %q", s.Label))
+		}
+		if s.Path != "" && paths[filepath.Clean(s.Path)] {
+			problems = append(problems, configError(key+"path", "sources: %s is listed twice", s.Path))
+		}
+		labels[s.Label] = true
+		paths[filepath.Clean(s.Path)] = true
+		if s.ShareLevel != "" && !validShareLevel(s.ShareLevel) {
+			problems = append(problems, configError(key+"share_level", "source %s: share_level must be none, metadata, or full", s.Label))
+		}
+	}
+	return problems
+}
+
+// sourceWarnings reports source share levels looser than a sink's level,
+// which do not apply to that sink
+func (c *Config) sourceWarnings() []*ConfigError {
+	var warnings []*ConfigError
+	sinks := c.Destinations()
+	for i, s := range c.ClaudeSources() {
+		if s.ShareLevel == "" || !validShareLevel(s.ShareLevel) || len(c.Sources) == 0 {
+			continue
+		}
+		for _, d := range sinks {
+			if StricterLevel(d.Sharing.Level, s.ShareLevel) != s.ShareLevel {
+				warnings = append(warnings, configError(fmt.Sprintf("sources.%d.share_level", i),
+					"source %s: share_level %s cannot loosen sink %s, which stays at %s", s.Label, s.ShareLevel, d.Name, d.Sharing.Level))
+			}
+		}
+	}
+	return warnings
+}
+
+// StricterLevel returns the more restrictive of two share levels. An
+// empty level imposes no restriction.
+func StricterLevel(a, b string) string {
+	rank := map[string]int{"none": 0, "metadata": 1, "full": 2}
+	if b == "" {
+		return a
+	}
+	if a == "" || rank[b] < rank[a] {
+		return b
+	}
+	return a
+}
+
+// ClaudeLogsPath returns the Claude Code data directory: $CLAUDE_CONFIG_DIR
+// if set, else ~/.claude
+func ClaudeLogsPath() string {
+	if dir := os.Getenv(EnvClaudeConfigDir); dir != "" {
+		return ExpandPath(dir)
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".claude")
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClaudeSources(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	tests := []struct {
+		name    string
+		env     string // CLAUDE_CONFIG_DIR
+		sources []SourceConfig
+		want    []SourceConfig
+	}{
+		{"default", "", nil, []SourceConfig{{Label: DefaultSourceLabel, Path: filepath.Join(home, ".claude")}}},
+		{"CLAUDE_CONFIG_DIR", "~/.claude-work", nil, []SourceConfig{{Label: DefaultSourceLabel, Path: filepath.Join(home, ".claude-work")}}},
+		{
+			"configured sources ignore CLAUDE_CONFIG_DIR",
+			"/elsewhere",
+			[]SourceConfig{{Label: "work", Path: "~/.claude-work", ShareLevel: "metadata"}},
+			[]SourceConfig{{Label: "work", Path: filepath.Join(home, ".claude-work"), ShareLevel: "metadata"}},
+		},
+		{
+			"label defaults to the directory name",
+			"",
+			[]SourceConfig{{Path: "/mnt/devcontainer/.claude"}},
+			[]SourceConfig{{Label: ".claude", Path: "/mnt/devcontainer/.claude"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvClaudeConfigDir, tt.env)
+			cfg := DefaultConfig()
+			cfg.Sources = tt.sources
+			if got := cfg.ClaudeSources(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ClaudeSources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []SourceConfig
+		want    []string // Keys of the problems
+	}{
+		{"distinct", []SourceConfig{{Label: "a", Path: "/a"}, {Label: "b", Path: "/b"}}, nil},
+		{"duplicate label", []SourceConfig{{Label: "a", Path: "/a"}, {Label: "a", Path: "/b"}}, []string{"sources.1.label"}},
+		{"defaulted labels collide", []SourceConfig{{Path: "/x/.claude"}, {Path: "/y/.claude"}}, []string{"sources.1.label"}},
+		{"duplicate path", []SourceConfig{{Label: "a", Path: "/a"}, {Label: "b", Path: "/a/"}}, []string{"sources.1.path"}},
+		{"invalid share level", []SourceConfig{{Label: "a", Path: "/a", ShareLevel: "some"}}, []string{"sources.0.share_level"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Sources = tt.sources
+			var got []string
+			for _, p := range cfg.sourceProblems() {
+				got = append(got, p.Key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceWarnings(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Sharing.Level = "metadata"
+	cfg.Sources = []SourceConfig{
+		{Label: "work", Path: "/w", ShareLevel: "full"},
+		{Label: "home", Path: "/h", ShareLevel: "none"},
+		{Label: "other", Path: "/o"},
+	}
+	warnings := cfg.sourceWarnings()
+	if len(warnings) != 1 || warnings[0].Key != "sources.0.share_level" || !strings.Contains(warnings[0].Message, "cannot loosen sink "+DefaultSinkName) {
+		t.Errorf("warnings = %v, want one for source work", warnings)
+	}
+}
+
+func TestStricterLevel(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"full", "metadata", "metadata"},
+		{"metadata", "full", "metadata"},
+		{"full", "none", "none"},
+		{"none", "full", "none"},
+		{"metadata", "", "metadata"},
+		{"", "none", "none"},
+		{"full", "full", "full"},
+	}
+	for _, tt := range tests {
+		if got := StricterLevel(tt.a, tt.b); got != tt.want {
+			t.Errorf("StricterLevel(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package credentials keeps API keys in a local file encrypted with
+// AES-256-GCM. The encryption key is generated on first use and stored
+// separately with owner-only permissions, so the credential file can sit
+// next to the config, or in a dotfile repository, without exposing keys.
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileVersion is the format version of the credential file
+const fileVersion = 1
+
+// additionalData is authenticated along with the secrets. It names the
+// format rather than the file, so the file can be moved or reached by
+// another path.
+var additionalData = []byte("claude-insights credentials v1")
+
+// ErrNotFound is returned for credentials the store does not hold
+var ErrNotFound = errors.New("credential not found")
+
+// Store is an encrypted credential file and the key file it is
+// encrypted with
+type Store struct {
+	path    string
+	keyPath string
+}
+
+// file is the on-disk form of the store
+type file struct {
+	Version int    `json:"version"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"` // Encrypted JSON object of name to secret
+}
+
+// Open returns the store at path, encrypted with the key at keyPath.
+// Neither file needs to exist yet.
+func Open(path, keyPath string) *Store {
+	return &Store{path: path, keyPath: keyPath}
+}
+
+// Get returns the named secret
+func (s *Store) Get(name string) (string, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return secret, nil
+}
+
+// Set stores a secret under name, replacing any previous one
+func (s *Store) Set(name, secret string) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = secret
+	return s.save(secrets)
+}
+
+// Delete removes the named secret
+func (s *Store) Delete(name string) error {
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(secrets, name)
+	return s.save(secrets)
+}
+
+func (s *Store) load() (map[string]string, error) {
+	secrets := make(map[string]string)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("read %s: %w", s.path, err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("read %s: unsupported version %d", s.path, f.Version)
+	}
+
+	aead, err := s.cipher(false)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Data, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: wrong key or corrupted file", s.path)
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("read %s: %w", s.path, err)
+	}
+	return secrets, nil
+}
+
+func (s *Store) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	aead, err := s.cipher(true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(file{
+		Version: fileVersion,
+		Nonce:   nonce,
+		Data:    aead.Seal(nil, nonce, plain, additionalData),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.path, data)
+}
+
+// cipher returns the AEAD for the store key, generating the key if create
+// is set and none exists
+func (s *Store) cipher(create bool) (cipher.AEAD, error) {
+	key, err := os.ReadFile(s.keyPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && create:
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := writeFile(s.keyPath, key); err != nil {
+			return nil, fmt.Errorf("write credential key: %w", err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("credential key %s is missing", s.keyPath)
+	case err != nil:
+		return nil, fmt.Errorf("read credential key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("credential key %s is not 32 bytes", s.keyPath)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFile writes data with owner-only permissions through a temporary
+// file
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Fingerprint identifies a secret without revealing it
+func Fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "SHA256:" + hex.EncodeToString(sum[:6])
+}
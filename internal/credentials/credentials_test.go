@@ -0,0 +1,161 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     [][2]string // Name and secret, in order
+		delete  []string
+		get     string
+		want    string
+		wantErr error
+	}{
+		{"stored", [][2]string{{"server", "key1"}}, nil, "server", "key1", nil},
+		{"replaced", [][2]string{{"server", "key1"}, {"server", "key2"}}, nil, "server", "key2", nil},
+		{"missing", [][2]string{{"server", "key1"}}, nil, "other", "", ErrNotFound},
+		{"deleted", [][2]string{{"server", "key1"}, {"other", "key2"}}, []string{"server"}, "server", "", ErrNotFound},
+		{"empty store", nil, nil, "server", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := Open(filepath.Join(dir, "config", "credentials.enc"), filepath.Join(dir, "state", "credentials.key"))
+			for _, kv := range tt.set {
+				if err := s.Set(kv[0], kv[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, name := range tt.delete {
+				if err := s.Delete(name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := s.Get(tt.get)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Get(%q) = %q, want %q", tt.get, got, tt.want)
+			}
+
+			if len(tt.set) > 0 {
+				data, err := os.ReadFile(s.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, kv := range tt.set {
+					if strings.Contains(string(data), kv[1]) {
+						t.Errorf("secret %q stored in plain text", kv[1])
+					}
+				}
+				for _, p := range []string{s.path, s.keyPath} {
+					info, err := os.Stat(p)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if info.Mode().Perm() != 0600 {
+						t.Errorf("%s mode = %v, want 0600", p, info.Mode().Perm())
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestStoreMoved checks that the credential file can still be decrypted
+// after it is moved or reached through another path
+func TestStoreMoved(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "credentials.key")
+	if err := Open(filepath.Join(dir, "a", "credentials.enc"), keyPath).Set("server", "key1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		move func(t *testing.T) string // Returns the path to open
+	}{
+		{"relative path", func(t *testing.T) string {
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chdir(wd) })
+			return filepath.Join("a", "credentials.enc")
+		}},
+		{"renamed directory", func(t *testing.T) string {
+			if err := os.Rename(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+				t.Fatal(err)
+			}
+			return filepath.Join(dir, "b", "credentials.enc")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Open(tt.move(t), keyPath).Get("server")
+			if err != nil || got != "key1" {
+				t.Errorf("Get = %q, %v, want key1", got, err)
+			}
+		})
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, s *Store)
+		wantErr string
+	}{
+		{"key missing", func(t *testing.T, s *Store) {
+			os.Remove(s.keyPath)
+		}, "is missing"},
+		{"other key", func(t *testing.T, s *Store) {
+			os.Remove(s.keyPath)
+			if _, err := s.cipher(true); err != nil {
+				t.Fatal(err)
+			}
+		}, "wrong key or corrupted file"},
+		{"short key", func(t *testing.T, s *Store) {
+			os.WriteFile(s.keyPath, []byte("short"), 0600)
+		}, "not 32 bytes"},
+		{"unknown version", func(t *testing.T, s *Store) {
+			os.WriteFile(s.path, []byte(`{"version":2}`), 0600)
+		}, "unsupported version 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := Open(filepath.Join(dir, "credentials.enc"), filepath.Join(dir, "credentials.key"))
+			if err := s.Set("server", "key1"); err != nil {
+				t.Fatal(err)
+			}
+			tt.corrupt(t, s)
+
+			_, err := s.Get("server")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a, b := Fingerprint("key1"), Fingerprint("key2")
+	if !strings.HasPrefix(a, "SHA256:") || len(a) != len("SHA256:")+12 {
+		t.Errorf("Fingerprint = %q", a)
+	}
+	if a == b || a != Fingerprint("key1") || strings.Contains(a, "key1") {
+		t.Errorf("fingerprints %q and %q", a, b)
+	}
+}
@@ -0,0 +1,134 @@
+'use strict';
+
+// Refresh the overview while the page is open
+const REFRESH_MS = 60000;
+
+const statuses = ['synced', 'excluded', 'pending', 'failed'];
+
+const fmtInt = n => n.toLocaleString();
+const fmtCost = n => '$' + n.toFixed(2);
+const fmtTime = s => new Date(s).toLocaleString();
+
+function el(tag, attrs = {}, ...children) {
+  const e = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs)) {
+    if (k === 'class') e.className = v;
+    else if (k === 'title') e.title = v;
+    else e.style.setProperty(k, v);
+  }
+  for (const c of children) e.append(c);
+  return e;
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url);
+  const body = await resp.json();
+  if (!resp.ok) throw new Error(body.error || resp.statusText);
+  return body;
+}
+
+function badges(list) {
+  const span = el('span');
+  for (const s of list) {
+    const title = s.sink + ': ' + s.status + (s.error ? ' – ' + s.error : '');
+    span.append(el('span', { class: 'badge ' + s.status, title }, s.sink));
+  }
+  return span;
+}
+
+function renderSummary(sum) {
+  document.getElementById('total-sessions').textContent = fmtInt(sum.sessions);
+  document.getElementById('total-tokens').textContent = fmtInt(sum.tokens);
+  document.getElementById('total-cost').textContent = fmtCost(sum.cost);
+  document.getElementById('sync-status').textContent =
+    statuses.map(s => (sum.statuses[s] || 0) + ' ' + s).join(', ');
+  document.getElementById('last-sync').textContent =
+    sum.last_sync ? 'Last sync ' + fmtTime(sum.last_sync) : 'Never synced';
+
+  const errors = document.getElementById('errors');
+  errors.hidden = !sum.errors;
+  errors.textContent = sum.errors ? 'Could not parse:\n' + sum.errors.join('\n') : '';
+
+  // Stacked bars: input including cache below, output on top
+  const chart = document.getElementById('chart');
+  chart.replaceChildren();
+  const total = d => d.tokens_in + d.cache_read + d.cache_write + d.tokens_out;
+  const max = Math.max(1, ...sum.days.map(total));
+  for (const d of sum.days) {
+    const input = d.tokens_in + d.cache_read + d.cache_write;
+    const title = `${d.date}: ${d.sessions} sessions, ${fmtInt(input)} in, ${fmtInt(d.tokens_out)} out, ${fmtCost(d.cost)}`;
+    chart.append(el('div', { class: 'day', title },
+      el('div', { class: 'bar-out', height: (100 * d.tokens_out / max) + '%' }),
+      el('div', { class: 'bar-in', height: (100 * input / max) + '%' })));
+  }
+  const cost = sum.days.reduce((a, d) => a + d.cost, 0);
+  document.getElementById('chart-legend').textContent = `Light: input incl. cache, dark: output. ${fmtCost(cost)} over ${sum.days.length} days.`;
+
+  const tools = document.querySelector('#tools tbody');
+  tools.replaceChildren(...(sum.tools || []).slice(0, 15).map(t =>
+    el('tr', {}, el('td', {}, t.name), el('td', { class: 'num' }, fmtInt(t.count)), el('td', { class: 'num' }, fmtInt(t.errors)))));
+
+  const sinks = document.querySelector('#sinks tbody');
+  sinks.replaceChildren(...sum.sinks.map(s =>
+    el('tr', {}, el('td', {}, s.name), ...statuses.map(st => el('td', { class: 'num' }, fmtInt(s.statuses[st] || 0))))));
+}
+
+function renderSessions(rows) {
+  const body = document.querySelector('#sessions tbody');
+  body.replaceChildren(...rows.map(r => {
+    const tr = el('tr', {},
+      el('td', {}, fmtTime(r.started_at)),
+      el('td', {}, r.project),
+      el('td', {}, r.source),
+      el('td', {}, r.model || ''),
+      el('td', { class: 'num' }, fmtInt(r.messages)),
+      el('td', { class: 'num' }, fmtInt(r.tokens_in + r.cache_read + r.cache_write) + ' / ' + fmtInt(r.tokens_out)),
+      el('td', { class: 'num' }, fmtInt(r.tool_calls)),
+      el('td', { class: 'num' }, fmtCost(r.cost)),
+      el('td', {}, badges(r.statuses)));
+    tr.addEventListener('click', () => showSession(r.id));
+    return tr;
+  }));
+}
+
+async function showSession(id, sink = '') {
+  const dialog = document.getElementById('detail');
+  const d = await getJSON('api/session?id=' + encodeURIComponent(id) + '&sink=' + encodeURIComponent(sink));
+
+  document.getElementById('detail-title').textContent = d.project + ' – ' + d.id;
+  document.getElementById('detail-meta').textContent =
+    `${fmtTime(d.started_at)} · ${d.source} · ${d.messages} messages · ${fmtCost(d.cost)}`;
+
+  const select = document.getElementById('detail-sink');
+  select.replaceChildren(...d.sinks.map(name => {
+    const o = el('option', {}, name);
+    o.value = name;
+    o.selected = name === d.sink;
+    return o;
+  }));
+  select.onchange = () => showSession(id, select.value);
+
+  const status = d.statuses.find(s => s.sink === d.sink);
+  document.getElementById('detail-status').replaceChildren(badges([status]),
+    status.error ? status.error : '', status.at ? ' ' + fmtTime(status.at) : '');
+  document.getElementById('detail-shared').textContent = d.shared
+    ? JSON.stringify(d.shared, null, 2)
+    : 'Nothing: this session is excluded by the sharing settings of ' + d.sink + '.';
+
+  if (!dialog.open) dialog.showModal();
+}
+
+async function refresh() {
+  try {
+    const [sum, rows] = await Promise.all([getJSON('api/summary'), getJSON('api/sessions')]);
+    renderSummary(sum);
+    renderSessions(rows);
+  } catch (err) {
+    const errors = document.getElementById('errors');
+    errors.hidden = false;
+    errors.textContent = 'Could not load data: ' + err.message;
+  }
+}
+
+refresh();
+setInterval(refresh, REFRESH_MS);
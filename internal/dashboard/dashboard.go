@@ -0,0 +1,358 @@
+// Package dashboard serves a local web UI showing parsed sessions, their
+// usage and what each sink received
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+	"github.com/dkd/claude-insights-agent/internal/pricing"
+	"github.com/dkd/claude-insights-agent/internal/watcher"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// historyDays is how many days the usage chart covers
+const historyDays = 30
+
+// defaultLimit caps the sessions listed when no limit is given
+const defaultLimit = 100
+
+// Server serves the dashboard UI and its JSON API
+type Server struct {
+	watcher *watcher.Watcher
+	logger  *slog.Logger
+	opts    Options
+
+	mu    sync.Mutex // Guards the cache and the watcher state
+	cache map[string]*cachedSession
+}
+
+// cachedSession is a parsed session log, valid while the file is unchanged
+type cachedSession struct {
+	modTime time.Time
+	size    int64
+	session *parser.Session
+}
+
+// New creates a dashboard over the sessions and state of w
+func New(w *watcher.Watcher, logger *slog.Logger, opts Options) *Server {
+	return &Server{watcher: w, logger: logger, opts: opts, cache: make(map[string]*cachedSession)}
+}
+
+// Handler returns the HTTP handler serving the UI and the API
+func (s *Server) Handler() http.Handler {
+	static, err := fs.Sub(assets, "assets")
+	if err != nil {
+		panic(err) // The embedded directory always exists
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(static)))
+	mux.HandleFunc("/api/summary", s.handleSummary)
+	mux.HandleFunc("/api/sessions", s.handleSessions)
+	mux.HandleFunc("/api/session", s.handleSession)
+	return s.guard(mux)
+}
+
+// Summary is the overview shown at the top of the dashboard
+type Summary struct {
+	Sessions int            `json:"sessions"`
+	Tokens   int            `json:"tokens"`
+	Cost     float64        `json:"cost"`
+	Days     []DayUsage     `json:"days"`
+	Tools    []ToolUsage    `json:"tools"`
+	Sinks    []SinkSummary  `json:"sinks"`
+	LastSync *time.Time     `json:"last_sync,omitempty"`
+	Statuses map[string]int `json:"statuses"` // Sessions by status across sinks
+	Models   map[string]int `json:"models"`   // Output tokens by model
+	Projects map[string]int `json:"projects"` // Sessions by project
+	Errors   []string       `json:"errors,omitempty"`
+}
+
+// DayUsage is the token usage and cost of the sessions started on a day
+type DayUsage struct {
+	Date       string  `json:"date"`
+	Sessions   int     `json:"sessions"`
+	TokensIn   int     `json:"tokens_in"`
+	TokensOut  int     `json:"tokens_out"`
+	CacheRead  int     `json:"cache_read"`
+	CacheWrite int     `json:"cache_write"`
+	Cost       float64 `json:"cost"`
+}
+
+// ToolUsage counts the calls of one tool
+type ToolUsage struct {
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+	Errors int    `json:"errors"`
+}
+
+// SinkSummary counts the sessions of a sink by status
+type SinkSummary struct {
+	Name     string         `json:"name"`
+	Statuses map[string]int `json:"statuses"`
+}
+
+// SessionRow is a session in the session list
+type SessionRow struct {
+	ID         string               `json:"id"`
+	Project    string               `json:"project"`
+	Source     string               `json:"source"`
+	StartedAt  time.Time            `json:"started_at"`
+	EndedAt    *time.Time           `json:"ended_at,omitempty"`
+	Model      string               `json:"model,omitempty"`
+	Messages   int                  `json:"messages"`
+	TokensIn   int                  `json:"tokens_in"`
+	TokensOut  int                  `json:"tokens_out"`
+	CacheRead  int                  `json:"cache_read"`
+	CacheWrite int                  `json:"cache_write"`
+	Cost       float64              `json:"cost"`
+	ToolCalls  int                  `json:"tool_calls"`
+	Statuses   []watcher.SinkStatus `json:"statuses"`
+}
+
+// SessionDetail is a session with what one sink received for it
+type SessionDetail struct {
+	SessionRow
+	Sink   string          `json:"sink"`
+	Sinks  []string        `json:"sinks"`
+	Shared *parser.Session `json:"shared"` // Nil if the sink excludes the session
+}
+
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, errs := s.sessions()
+	summary := Summary{
+		Sessions: len(sessions),
+		Statuses: make(map[string]int),
+		Models:   make(map[string]int),
+		Projects: make(map[string]int),
+		Errors:   errs,
+	}
+
+	// One entry per day, oldest first, so gaps show in the chart
+	today := time.Now()
+	days := make(map[string]*DayUsage, historyDays)
+	for i := historyDays - 1; i >= 0; i-- {
+		date := today.AddDate(0, 0, -i).Format(time.DateOnly)
+		summary.Days = append(summary.Days, DayUsage{Date: date})
+	}
+	for i := range summary.Days {
+		days[summary.Days[i].Date] = &summary.Days[i]
+	}
+
+	tools := make(map[string]*ToolUsage)
+	sinks := make(map[string]*SinkSummary)
+	for _, name := range s.watcher.SinkNames() {
+		sinks[name] = &SinkSummary{Name: name, Statuses: make(map[string]int)}
+	}
+
+	for _, session := range sessions {
+		row := s.row(session)
+		summary.Tokens += row.TokensIn + row.TokensOut + row.CacheRead + row.CacheWrite
+		summary.Cost += row.Cost
+		summary.Projects[row.Project]++
+
+		if d := days[session.StartedAt.Local().Format(time.DateOnly)]; d != nil {
+			d.Sessions++
+			d.TokensIn += row.TokensIn
+			d.TokensOut += row.TokensOut
+			d.CacheRead += row.CacheRead
+			d.CacheWrite += row.CacheWrite
+			d.Cost += row.Cost
+		}
+		for model, m := range session.Models {
+			summary.Models[model] += m.OutputTokens
+		}
+		for name, t := range session.Tools {
+			tu := tools[name]
+			if tu == nil {
+				tu = &ToolUsage{Name: name}
+				tools[name] = tu
+			}
+			tu.Count += t.Count
+			tu.Errors += t.Errors
+		}
+		for _, st := range row.Statuses {
+			summary.Statuses[st.Status]++
+			if sinks[st.Sink] != nil {
+				sinks[st.Sink].Statuses[st.Status]++
+			}
+		}
+	}
+
+	for _, t := range tools {
+		summary.Tools = append(summary.Tools, *t)
+	}
+	sort.Slice(summary.Tools, func(i, j int) bool {
+		if summary.Tools[i].Count != summary.Tools[j].Count {
+			return summary.Tools[i].Count > summary.Tools[j].Count
+		}
+		return summary.Tools[i].Name < summary.Tools[j].Name
+	})
+	for _, name := range s.watcher.SinkNames() {
+		summary.Sinks = append(summary.Sinks, *sinks[name])
+	}
+	if stats := s.watcher.GetStats(); !stats.LastSync.IsZero() {
+		summary.LastSync = &stats.LastSync
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, _ := s.sessions()
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	rows := make([]SessionRow, 0, len(sessions))
+	for _, session := range sessions {
+		rows = append(rows, s.row(session))
+	}
+	writeJSON(w, http.StatusOK, rows)
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	sinkName := r.URL.Query().Get("sink")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sinks := s.watcher.SinkNames()
+	if sinkName == "" && len(sinks) > 0 {
+		sinkName = sinks[0]
+	}
+
+	sessions, _ := s.sessions()
+	for _, session := range sessions {
+		if session.ID != id {
+			continue
+		}
+		shared, ok := s.watcher.Shared(session, sinkName)
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown sink "+sinkName)
+			return
+		}
+		writeJSON(w, http.StatusOK, SessionDetail{
+			SessionRow: s.row(session),
+			Sink:       sinkName,
+			Sinks:      sinks,
+			Shared:     shared,
+		})
+		return
+	}
+	writeError(w, http.StatusNotFound, "unknown session "+id)
+}
+
+// sessions returns all sessions, newest first, re-parsing only logs that
+// changed since the last call, plus the parse errors. It also reloads the
+// sync state so statuses reflect a running daemon. Callers hold s.mu.
+func (s *Server) sessions() ([]*parser.Session, []string) {
+	if err := s.watcher.ReloadState(); err != nil {
+		s.logger.Warn("Could not load sync state", "error", err)
+	}
+
+	files, err := s.watcher.SessionFiles()
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	var errs []string
+	seen := make(map[string]bool, len(files))
+	sessions := make([]*parser.Session, 0, len(files))
+	for _, f := range files {
+		seen[f] = true
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+
+		c := s.cache[f]
+		if c == nil || !c.modTime.Equal(info.ModTime()) || c.size != info.Size() {
+			session, err := s.watcher.ParseSession(f)
+			if err != nil {
+				errs = append(errs, f+": "+err.Error())
+				delete(s.cache, f)
+				continue
+			}
+			c = &cachedSession{modTime: info.ModTime(), size: info.Size(), session: session}
+			s.cache[f] = c
+		}
+		sessions = append(sessions, c.session)
+	}
+
+	// Forget deleted logs
+	for f := range s.cache {
+		if !seen[f] {
+			delete(s.cache, f)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.After(sessions[j].StartedAt)
+	})
+	return sessions, errs
+}
+
+// row summarizes a session for the session list
+func (s *Server) row(session *parser.Session) SessionRow {
+	row := SessionRow{
+		ID:         session.ID,
+		Project:    session.ProjectName,
+		Source:     session.Source,
+		StartedAt:  session.StartedAt,
+		EndedAt:    session.EndedAt,
+		Model:      session.Model,
+		Messages:   session.TotalMessages,
+		TokensIn:   session.TotalTokensIn,
+		TokensOut:  session.TotalTokensOut,
+		CacheRead:  session.TotalCacheRead,
+		CacheWrite: session.TotalCacheWrite,
+		Statuses:   s.watcher.SessionStatus(session),
+	}
+	for model, m := range session.Models {
+		row.Cost += pricing.Cost(model, m.InputTokens, m.OutputTokens, m.CacheReadTokens, m.CacheCreationTokens)
+	}
+	for _, t := range session.Tools {
+		row.ToolCalls += t.Count
+	}
+	return row
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,121 @@
+package dashboard
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tokenCookie keeps the access token after the first visit with ?token=
+const tokenCookie = "claude_insights_token"
+
+// Options restricts who may use the dashboard
+type Options struct {
+	// Hosts are the names the dashboard may be reached by besides loopback
+	// ones. Other Host headers are rejected, so a page on another site cannot
+	// reach the dashboard by rebinding its name to a local address
+	Hosts []string
+
+	// Token, if set, must be sent with every request: as ?token=, which
+	// also sets a cookie for the rest of the visit, as the cookie, or as a
+	// bearer token
+	Token string
+}
+
+// IsLoopback reports whether a listen address only accepts connections
+// from this machine. An empty host listens on all interfaces
+func IsLoopback(listen string) bool {
+	host := hostOnly(listen)
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ListenHosts returns the names the dashboard may be reached by when it
+// listens on addr: its host, or for all interfaces the hostname and the
+// addresses of this machine
+func ListenHosts(listen string) []string {
+	host := hostOnly(listen)
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return []string{host}
+	}
+
+	var hosts []string
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			hosts = append(hosts, ipNet.IP.String())
+		}
+	}
+	return hosts
+}
+
+// guard rejects requests for unknown hosts or without the token
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, "host not allowed")
+			return
+		}
+		if s.opts.Token != "" {
+			if q := r.URL.Query().Get("token"); q != "" && s.validToken(q) {
+				http.SetCookie(w, &http.Cookie{
+					Name:     tokenCookie,
+					Value:    q,
+					Path:     "/",
+					HttpOnly: true,
+					SameSite: http.SameSiteStrictMode,
+				})
+			} else if !s.validToken(requestToken(r)) {
+				writeError(w, http.StatusUnauthorized, "missing or invalid token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether a Host header names a loopback address or
+// one of the configured hosts
+func (s *Server) allowedHost(hostport string) bool {
+	host := hostOnly(hostport)
+	if IsLoopback(host) {
+		return true
+	}
+	for _, h := range s.opts.Hosts {
+		if strings.EqualFold(host, strings.Trim(h, "[]")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+// requestToken returns the token of the cookie or the Authorization header
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// hostOnly strips the port and IPv6 brackets from a host or address
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.Trim(hostport, "[]")
+}
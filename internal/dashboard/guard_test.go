@@ -0,0 +1,102 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       Options
+		host       string
+		target     string
+		header     string // Authorization header
+		cookie     string
+		wantStatus int
+		wantCookie bool
+	}{
+		{"loopback ip", Options{}, "127.0.0.1:8765", "/api/summary", "", "", http.StatusOK, false},
+		{"localhost", Options{}, "localhost:8765", "/", "", "", http.StatusOK, false},
+		{"ipv6 loopback", Options{}, "[::1]:8765", "/", "", "", http.StatusOK, false},
+		{"rebound name", Options{}, "evil.example:8765", "/api/session?id=s1", "", "", http.StatusForbidden, false},
+		{"listen host", Options{Hosts: []string{"devbox"}}, "DEVBOX:9000", "/", "", "", http.StatusOK, false},
+		{"other host with token", Options{Hosts: []string{"devbox"}, Token: "secret"}, "evil.example", "/?token=secret", "", "", http.StatusForbidden, false},
+		{"token missing", Options{Token: "secret"}, "127.0.0.1", "/api/summary", "", "", http.StatusUnauthorized, false},
+		{"token wrong", Options{Token: "secret"}, "127.0.0.1", "/?token=guess", "", "", http.StatusUnauthorized, false},
+		{"token in query", Options{Token: "secret"}, "127.0.0.1", "/?token=secret", "", "", http.StatusOK, true},
+		{"token in cookie", Options{Token: "secret"}, "127.0.0.1", "/api/summary", "", "secret", http.StatusOK, false},
+		{"bearer token", Options{Token: "secret"}, "127.0.0.1", "/api/summary", "Bearer secret", "", http.StatusOK, false},
+		{"wrong bearer token", Options{Token: "secret"}, "127.0.0.1", "/api/summary", "Bearer guess", "secret", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{opts: tt.opts}
+			h := s.guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: tokenCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if gotCookie := len(w.Result().Cookies()) > 0; gotCookie != tt.wantCookie {
+				t.Errorf("cookie set = %v, want %v", gotCookie, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   bool
+	}{
+		{"127.0.0.1:8765", true},
+		{"localhost:8765", true},
+		{"[::1]:8765", true},
+		{":9000", false},
+		{"0.0.0.0:9000", false},
+		{"192.168.1.10:9000", false},
+		{"devbox:9000", false},
+	}
+	for _, tt := range tests {
+		if got := IsLoopback(tt.listen); got != tt.want {
+			t.Errorf("IsLoopback(%q) = %v, want %v", tt.listen, got, tt.want)
+		}
+	}
+}
+
+func TestListenHosts(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   []string // Nil for the addresses of this machine
+	}{
+		{"devbox:9000", []string{"devbox"}},
+		{"192.168.1.10:9000", []string{"192.168.1.10"}},
+		{"[fe80::1]:9000", []string{"fe80::1"}},
+		{":9000", nil},
+		{"0.0.0.0:9000", nil},
+	}
+	for _, tt := range tests {
+		got := ListenHosts(tt.listen)
+		if tt.want == nil {
+			if len(got) == 0 {
+				t.Errorf("ListenHosts(%q) is empty", tt.listen)
+			}
+			continue
+		}
+		if len(got) != len(tt.want) || got[0] != tt.want[0] {
+			t.Errorf("ListenHosts(%q) = %v, want %v", tt.listen, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package filter
 
 import (
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/dkd/claude-insights-agent/internal/config"
@@ -27,23 +28,39 @@ func (f *Filter) Apply(s *parser.Session) *parser.Session {
 
 	// Create filtered copy
 	filtered := &parser.Session{
-		ID:             s.ID,
-		StartedAt:      s.StartedAt,
-		EndedAt:        s.EndedAt,
-		TotalMessages:  s.TotalMessages,
-		TotalTokensIn:  s.TotalTokensIn,
-		TotalTokensOut: s.TotalTokensOut,
-		Model:          s.Model,
-		Tools:          s.Tools,
-		Tags:           s.Tags,
-		TokenUsage:     s.TokenUsage, // Always include token stats
+		ID:                s.ID,
+		Source:            s.Source,
+		StartedAt:         s.StartedAt,
+		EndedAt:           s.EndedAt,
+		TotalMessages:     s.TotalMessages,
+		TotalTokensIn:     s.TotalTokensIn,
+		TotalTokensOut:    s.TotalTokensOut,
+		TotalCacheRead:    s.TotalCacheRead,
+		TotalCacheWrite:   s.TotalCacheWrite,
+		EffectiveTokensIn: s.EffectiveTokensIn,
+		CacheHitRatio:     s.CacheHitRatio,
+		Model:             s.Model,
+		Models:            s.Models,
+		Tools:             s.Tools,
+		Tags:              s.Tags,
+		Commands:          s.Commands,
+		ActiveSeconds:     s.ActiveSeconds,
+		IdleGaps:          s.IdleGaps,
+		IdleSeconds:       s.IdleSeconds,
+		AvgResponseMs:     s.AvgResponseMs,
+		AvgThinkMs:        s.AvgThinkMs,
+		Turns:             s.Turns,
+		TokenUsage:        s.TokenUsage, // Always include token stats
 	}
 
 	// Anonymize or include project name
-	if f.cfg.AnonymizePaths {
-		filtered.ProjectName = filepath.Base(s.ProjectPath)
-	} else {
-		filtered.ProjectName = s.ProjectPath
+	filtered.ProjectName = f.projectName(s.ProjectPath)
+
+	// Todo counts are metadata, item text is content
+	if s.Todos != nil {
+		todos := *s.Todos
+		todos.Items = nil
+		filtered.Todos = &todos
 	}
 
 	// Apply share level
@@ -56,34 +73,132 @@ func (f *Filter) Apply(s *parser.Session) *parser.Session {
 		// Share metadata only, no message content or tool details
 		filtered.Messages = nil
 		filtered.ToolCalls = nil
+		filtered.CommandCalls = nil
 
 	case "full":
 		// Share everything including messages and tool calls
 		filtered.Messages = s.Messages
 		filtered.ToolCalls = s.ToolCalls
+		filtered.CommandCalls = s.CommandCalls
+		filtered.Todos = s.Todos
 	}
 
 	return filtered
 }
 
+// ApplyPlan filters a plan according to share level settings. Plans not
+// yet linked to a session are withheld while projects are excluded,
+// since their project is unknown; see HoldsPlan.
+func (f *Filter) ApplyPlan(p *parser.Plan) *parser.Plan {
+	// Check if the owning project is excluded
+	if f.HoldsPlan(p) || f.isExcluded(p.ProjectPath) {
+		return nil
+	}
+
+	filtered := *p
+	if p.ProjectPath != "" {
+		filtered.ProjectName = f.projectName(p.ProjectPath)
+	}
+
+	// Headings are shared at every level, so redact them like content
+	filtered.Title = Redact(p.Title)
+	filtered.Sections = redactSections(p.Sections)
+
+	// Apply share level
+	switch f.cfg.Level {
+	case "none":
+		// Don't share anything
+		return nil
+
+	case "metadata":
+		// Share title, section tree, checklist counts, code block stats and size only
+		filtered.Content = ""
+		filtered.Frontmatter = nil
+		filtered.Checklist = nil
+		filtered.Files = nil
+		filtered.Diff = ""
+
+	case "full":
+		// Share content with secrets redacted
+		filtered.Content = Redact(p.Content)
+		filtered.Diff = Redact(p.Diff)
+		filtered.Frontmatter = redactValue(p.Frontmatter).(map[string]any)
+		filtered.Checklist = make([]parser.ChecklistItem, len(p.Checklist))
+		for i, item := range p.Checklist {
+			item.Text = Redact(item.Text)
+			item.Section = Redact(item.Section)
+			filtered.Checklist[i] = item
+		}
+	}
+
+	return &filtered
+}
+
+// HoldsPlan reports whether a plan is withheld only until it is linked to
+// a session, because exclude_projects cannot be checked without knowing
+// its project
+func (f *Filter) HoldsPlan(p *parser.Plan) bool {
+	return p.ProjectPath == "" && len(f.cfg.ExcludeProjects) > 0
+}
+
+// projectName returns the project name to share, anonymized if configured
+func (f *Filter) projectName(projectPath string) string {
+	if f.cfg.AnonymizePaths {
+		return filepath.Base(projectPath)
+	}
+	return projectPath
+}
+
 // isExcluded checks if project matches any exclusion pattern
 func (f *Filter) isExcluded(projectPath string) bool {
+	if projectPath == "" {
+		return false
+	}
 	for _, pattern := range f.cfg.ExcludeProjects {
-		matched, _ := filepath.Match(pattern, projectPath)
-		if matched {
+		if globRegexp(pattern).MatchString(projectPath) {
 			return true
 		}
-		// Also check if pattern matches any part of the path
-		if strings.Contains(pattern, "**") {
-			// Simple glob matching for **
-			cleanPattern := strings.ReplaceAll(pattern, "**", "*")
-			parts := strings.Split(projectPath, "/")
-			for _, part := range parts {
-				if matched, _ := filepath.Match(cleanPattern, part); matched {
-					return true
-				}
+	}
+	return false
+}
+
+// globRegexp translates an exclusion pattern to a regular expression
+// matching whole paths. * and ? stay within one path segment, ** spans
+// any number of them: a leading **/ matches any parent directories and a
+// trailing /** the directory itself and everything below it.
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	rest := pattern
+	if strings.HasPrefix(rest, "**/") {
+		b.WriteString("(?:.*/)?")
+		rest = rest[3:]
+	}
+	suffix := ""
+	if strings.HasSuffix(rest, "/**") {
+		suffix = "(?:/.*)?"
+		rest = strings.TrimSuffix(rest, "/**")
+	}
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "**"):
+			b.WriteString(".*")
+			rest = rest[2:]
+		case rest[0] == '*':
+			b.WriteString("[^/]*")
+			rest = rest[1:]
+		case rest[0] == '?':
+			b.WriteString("[^/]")
+			rest = rest[1:]
+		default:
+			n := strings.IndexAny(rest, "*?")
+			if n < 0 {
+				n = len(rest)
 			}
+			b.WriteString(regexp.QuoteMeta(rest[:n]))
+			rest = rest[n:]
 		}
 	}
-	return false
+	b.WriteString(suffix + "$")
+	return regexp.MustCompile(b.String())
 }
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// redactedPlaceholder replaces any detected secret
+const redactedPlaceholder = "[REDACTED]"
+
+// secretPatterns match common credentials that must never leave the machine
+var secretPatterns = []*regexp.Regexp{
+	// Private key blocks
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`),
+	// Provider API keys and tokens
+	regexp.MustCompile(`\bsk-(?:ant-)?[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`\bdkd_sk_[A-Za-z0-9_-]{8,}`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`),
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	// Bearer tokens in headers
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{20,}`),
+	// Credentials embedded in URLs
+	regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`),
+}
+
+// secretAssignment matches key=value style assignments of sensitive names
+var secretAssignment = regexp.MustCompile(`(?i)\b((?:api[_-]?key|secret|token|password|passwd|pwd)[A-Za-z0-9_]*\s*[:=]\s*)(["']?)[^\s"']{6,}(["']?)`)
+
+// Redact replaces detected secrets in text with a placeholder
+func Redact(text string) string {
+	for _, re := range secretPatterns {
+		text = re.ReplaceAllString(text, redactedPlaceholder)
+	}
+	return secretAssignment.ReplaceAllString(text, "${1}${2}"+redactedPlaceholder+"${3}")
+}
+
+// redactValue redacts secrets in all strings of a decoded YAML/JSON value
+func redactValue(v any) any {
+	switch val := v.(type) {
+	case string:
+		return Redact(val)
+	case map[string]any:
+		if val == nil {
+			return val
+		}
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = redactValue(item)
+		}
+		return out
+	case map[any]any:
+		// yaml.v3 decodes mappings with non-string keys like this, which
+		// JSON cannot encode, so keys become strings
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = redactValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = redactValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// redactSections returns a copy of a section tree with secrets in the
+// titles redacted
+func redactSections(sections []*parser.Section) []*parser.Section {
+	if sections == nil {
+		return nil
+	}
+	out := make([]*parser.Section, len(sections))
+	for i, s := range sections {
+		c := *s
+		c.Title = Redact(s.Title)
+		c.Children = redactSections(s.Children)
+		out[i] = &c
+	}
+	return out
+}
@@ -0,0 +1,183 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Revision represents a single recorded version of a plan
+type Revision struct {
+	Number    int       `json:"revision"`
+	Hash      string    `json:"hash"`
+	Parent    string    `json:"parent,omitempty"` // Hash of the previous revision
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Synced    bool      `json:"synced,omitempty"` // Legacy, sync state is now kept per sink
+}
+
+// index lists the revisions of a single plan, oldest first
+type index struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+// Store keeps a content-addressed history of plan revisions on disk.
+// Contents live in objects/<hash[:2]>/<hash>, revision lists in
+// plans/<key>.json, where key is the plan's parser.Plan.Key.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New creates a Store rooted at dir
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Hash returns the content address of the given content
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record stores content as a new revision of the plan with the given key
+// if it differs from the latest revision. It returns the latest revision and whether a
+// new one was created.
+func (s *Store) Record(key string, content []byte, at time.Time) (*Revision, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, err := s.loadIndex(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hash := Hash(content)
+	var parent string
+	if n := len(idx.Revisions); n > 0 {
+		last := idx.Revisions[n-1]
+		if last.Hash == hash {
+			return &last, false, nil
+		}
+		parent = last.Hash
+	}
+
+	if err := s.writeObject(hash, content); err != nil {
+		return nil, false, err
+	}
+
+	rev := Revision{
+		Number:    len(idx.Revisions) + 1,
+		Hash:      hash,
+		Parent:    parent,
+		Size:      len(content),
+		CreatedAt: at,
+	}
+	idx.Revisions = append(idx.Revisions, rev)
+	if err := s.saveIndex(key, idx); err != nil {
+		return nil, false, err
+	}
+
+	return &rev, true, nil
+}
+
+// Since returns the revisions of the plan with the given key newer than
+// revision after
+func (s *Store) Since(key string, after int) ([]Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, err := s.loadIndex(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+	for _, rev := range idx.Revisions {
+		if rev.Number > after {
+			revisions = append(revisions, rev)
+		}
+	}
+	return revisions, nil
+}
+
+// LegacySynced returns the newest revision of the plan with the given key
+// flagged as synced by agents that kept sync state in the history itself
+func (s *Store) LegacySynced(key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, err := s.loadIndex(key)
+	if err != nil {
+		return 0, err
+	}
+
+	last := 0
+	for _, rev := range idx.Revisions {
+		if rev.Synced && rev.Number > last {
+			last = rev.Number
+		}
+	}
+	return last, nil
+}
+
+// Content returns the stored content for a hash
+func (s *Store) Content(hash string) ([]byte, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	return os.ReadFile(s.objectPath(hash))
+}
+
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash)
+}
+
+func (s *Store) indexPath(key string) string {
+	return filepath.Join(s.dir, "plans", filepath.FromSlash(key)+".json")
+}
+
+// writeObject stores content under its hash unless it already exists
+func (s *Store) writeObject(hash string, content []byte) error {
+	path := s.objectPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
+
+// loadIndex reads the revision list of a plan, empty if none exists
+func (s *Store) loadIndex(key string) (*index, error) {
+	data, err := os.ReadFile(s.indexPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &index{}, nil
+		}
+		return nil, err
+	}
+
+	idx := &index{}
+	return idx, json.Unmarshal(data, idx)
+}
+
+// saveIndex persists the revision list of a plan
+func (s *Store) saveIndex(key string, idx *index) error {
+	path := s.indexPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
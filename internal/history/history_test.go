@@ -0,0 +1,189 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name      string
+		records   []string // Contents recorded in order, for key "plan"
+		wantNew   []bool
+		wantCount int
+	}{
+		{"first", []string{"a"}, []bool{true}, 1},
+		{"unchanged", []string{"a", "a"}, []bool{true, false}, 1},
+		{"changed", []string{"a", "b"}, []bool{true, true}, 2},
+		{"changed back", []string{"a", "b", "a"}, []bool{true, true, true}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(t.TempDir())
+			var parent string
+			for i, content := range tt.records {
+				rev, created, err := s.Record("plan", []byte(content), at)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if created != tt.wantNew[i] {
+					t.Errorf("record %d: created = %v, want %v", i, created, tt.wantNew[i])
+				}
+				if !created {
+					continue
+				}
+				if rev.Hash != Hash([]byte(content)) || rev.Parent != parent || rev.Size != len(content) {
+					t.Errorf("record %d: revision %+v", i, rev)
+				}
+				parent = rev.Hash
+			}
+
+			revisions, err := s.Since("plan", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != tt.wantCount {
+				t.Fatalf("revisions = %d, want %d", len(revisions), tt.wantCount)
+			}
+			for i, rev := range revisions {
+				if rev.Number != i+1 {
+					t.Errorf("revision %d numbered %d", i, rev.Number)
+				}
+			}
+			if later, _ := s.Since("plan", 1); len(later) != tt.wantCount-1 {
+				t.Errorf("revisions after 1 = %d, want %d", len(later), tt.wantCount-1)
+			}
+
+			last := revisions[len(revisions)-1]
+			content, err := s.Content(last.Hash)
+			if err != nil || string(content) != tt.records[len(tt.records)-1] {
+				t.Errorf("content = %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestRecordKeys(t *testing.T) {
+	s := New(t.TempDir())
+	for _, key := range []string{"plan", "work/plan", "home/plan"} {
+		if _, _, err := s.Record(key, []byte(key), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"plan", "work/plan", "home/plan"} {
+		revisions, err := s.Since(key, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 1 || revisions[0].Hash != Hash([]byte(key)) {
+			t.Errorf("%s: revisions = %+v", key, revisions)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    string
+		want        string
+		wantAdded   int
+		wantRemoved int
+	}{
+		{
+			name: "unchanged",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+		},
+		{
+			name:      "created",
+			old:       "",
+			new:       "a\nb\n",
+			want:      "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+			wantAdded: 2,
+		},
+		{
+			name:        "emptied",
+			old:         "a\n",
+			new:         "",
+			want:        "--- old\n+++ new\n@@ -1,1 +0,0 @@\n-a\n",
+			wantRemoved: 1,
+		},
+		{
+			name:        "changed line",
+			old:         "a\nb\nc\n",
+			new:         "a\nB\nc\n",
+			want:        "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			wantAdded:   1,
+			wantRemoved: 1,
+		},
+		{
+			name:      "insertion keeps common lines",
+			old:       "a\nc\n",
+			new:       "a\nb\nc\n",
+			want:      "--- old\n+++ new\n@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+			wantAdded: 1,
+		},
+		{
+			name:      "missing trailing newline",
+			old:       "a\nb",
+			new:       "a\nb\nc",
+			want:      "--- old\n+++ new\n@@ -1,2 +1,3 @@\n a\n b\n+c\n",
+			wantAdded: 1,
+		},
+		{
+			name:        "distant changes make separate hunks",
+			old:         "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:         "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want:        "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+			wantAdded:   2,
+			wantRemoved: 2,
+		},
+		{
+			name:        "close changes share a hunk",
+			old:         "1\n2\n3\n4\n5\n",
+			new:         "one\n2\n3\n4\nfive\n",
+			want:        "--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+one\n 2\n 3\n 4\n-5\n+five\n",
+			wantAdded:   2,
+			wantRemoved: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, added, removed := Diff("old", "new", tt.old, tt.new)
+			if got != tt.want {
+				t.Errorf("diff:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if added != tt.wantAdded || removed != tt.wantRemoved {
+				t.Errorf("added, removed = %d, %d, want %d, %d", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLCS(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string // Operation kinds in order
+	}{
+		{"empty", nil, nil, ""},
+		{"equal", []string{"x", "y"}, []string{"x", "y"}, "  "},
+		{"replace all", []string{"x"}, []string{"y"}, "-+"},
+		{"longest common subsequence", []string{"a", "b", "c", "d"}, []string{"b", "x", "d"}, "- -+ "},
+		{"moved line", []string{"a", "b", "c"}, []string{"c", "a", "b"}, "+  -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(tt.a, tt.b)
+			kinds := make([]byte, len(ops))
+			for i, op := range ops {
+				kinds[i] = op.kind
+			}
+			if string(kinds) != tt.want {
+				t.Errorf("ops = %q, want %q", kinds, tt.want)
+			}
+		})
+	}
+}
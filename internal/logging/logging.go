@@ -0,0 +1,73 @@
+// Package logging builds the agent's structured logger from config
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel converts a config level name to a slog level
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", level)
+}
+
+// New creates a logger writing to cfg.File, rotated by size and age, or
+// to fallback if no file is configured. The returned closer closes the
+// log file.
+func New(cfg config.LoggingConfig, fallback io.Writer) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, closer := fallback, io.Closer(nopCloser{})
+	if cfg.File != "" {
+		f, err := OpenRotating(config.ExpandPath(cfg.File), cfg.MaxSizeMB, cfg.MaxAgeDays, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, closer = f, f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(out, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	return slog.New(handler), closer, nil
+}
+
+// Discard returns a logger that drops everything
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
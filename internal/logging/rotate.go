@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted into rotated file names
+const backupTimeFormat = "20060102-150405.000"
+
+// RotatingFile is a log file that is renamed aside once it reaches a size
+// or age limit. Rotated files older than the age limit or beyond the backup
+// count are deleted.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time // When the first line of the current file was written
+}
+
+// OpenRotating opens path for appending. A zero limit disables it.
+func OpenRotating(path string, maxSizeMB, maxAgeDays, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		maxBackups: maxBackups,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create log directory: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.prune()
+	return r, nil
+}
+
+// Write appends p, rotating first if p would exceed the size limit or the
+// current file is older than the age limit. If rotating fails, p still
+// goes to the current file and the error is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		// A failed rotation left no file open
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	var rotateErr error
+	if r.due(len(p)) {
+		rotateErr = r.rotate()
+		if r.file == nil {
+			return 0, rotateErr
+		}
+	}
+	if r.size == 0 {
+		r.started = time.Now()
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+// due reports whether the current file must be rotated before writing n
+// bytes
+func (r *RotatingFile) due(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	tooBig := r.maxSize > 0 && r.size+int64(n) > r.maxSize
+	tooOld := r.maxAge > 0 && time.Since(r.started) > r.maxAge
+	return tooBig || tooOld
+}
+
+// Close closes the current file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open log file: %w", err)
+	}
+	r.file, r.size = f, info.Size()
+	r.started = r.startTime(info)
+	return nil
+}
+
+// startTime estimates when the first line of an existing file was written:
+// at the last rotation, else no later than its last write
+func (r *RotatingFile) startTime(info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+	started := info.ModTime()
+	var last time.Time
+	for _, b := range r.backups() {
+		if b.at.After(last) {
+			last = b.at
+		}
+	}
+	if !last.IsZero() && last.Before(started) {
+		started = last
+	}
+	return started
+}
+
+// rotate renames the current file aside and starts a new one. If the
+// rename fails, the current file is reopened. Callers hold r.mu.
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(r.path, ext), time.Now().Format(backupTimeFormat), ext)
+	if err := os.Rename(r.path, backup); err != nil {
+		err = fmt.Errorf("rotate log file: %w", err)
+		if openErr := r.open(); openErr != nil {
+			r.file = nil
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+// prune deletes rotated files beyond the age and count limits
+func (r *RotatingFile) prune() {
+	if r.maxAge <= 0 && r.maxBackups <= 0 {
+		return
+	}
+
+	backups := r.backups()
+	// Newest first
+	sort.Slice(backups, func(i, j int) bool { return backups[i].at.After(backups[j].at) })
+	for i, b := range backups {
+		tooOld := r.maxAge > 0 && time.Since(b.at) > r.maxAge
+		tooMany := r.maxBackups > 0 && i >= r.maxBackups
+		if tooOld || tooMany {
+			os.Remove(b.path)
+		}
+	}
+}
+
+type backup struct {
+	path string
+	at   time.Time
+}
+
+// backups lists rotated files with the time they were rotated
+func (r *RotatingFile) backups() []backup {
+	ext := filepath.Ext(r.path)
+	prefix := filepath.Base(strings.TrimSuffix(r.path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return nil
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		at, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(filepath.Dir(r.path), name), at: at})
+	}
+	return backups
+}
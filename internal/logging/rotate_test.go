@@ -0,0 +1,177 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLog returns the content of the active file and of all backups
+func readLog(t *testing.T, r *RotatingFile) (string, []string) {
+	t.Helper()
+	active, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backups []string
+	for _, b := range r.backups() {
+		data, err := os.ReadFile(b.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, string(data))
+	}
+	return string(active), backups
+}
+
+func TestRotatingFileWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int64
+		maxAge      time.Duration
+		startedAgo  time.Duration // Age of the active file before the write
+		wantActive  string
+		wantBackups int
+	}{
+		{"within limits", 100, 24 * time.Hour, time.Hour, "first\nsecond\n", 0},
+		{"too big", 10, 0, 0, "second\n", 1},
+		{"too old", 0, 24 * time.Hour, 25 * time.Hour, "second\n", 1},
+		{"no limits", 0, 0, 1000 * time.Hour, "first\nsecond\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := OpenRotating(filepath.Join(t.TempDir(), "agent.log"), 0, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			r.maxSize, r.maxAge = tt.maxSize, tt.maxAge
+
+			if _, err := r.Write([]byte("first\n")); err != nil {
+				t.Fatal(err)
+			}
+			r.started = time.Now().Add(-tt.startedAgo)
+			if _, err := r.Write([]byte("second\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			active, backups := readLog(t, r)
+			if active != tt.wantActive {
+				t.Errorf("active = %q, want %q", active, tt.wantActive)
+			}
+			if len(backups) != tt.wantBackups {
+				t.Fatalf("backups = %q, want %d", backups, tt.wantBackups)
+			}
+			if tt.wantBackups > 0 && backups[0] != "first\n" {
+				t.Errorf("backup = %q, want %q", backups[0], "first\n")
+			}
+		})
+	}
+}
+
+func TestRotateRenameFails(t *testing.T) {
+	tests := []struct {
+		name string
+		// breakPath makes renaming the active file fail
+		breakPath  func(t *testing.T, path string)
+		wantActive string
+	}{
+		{"file removed", func(t *testing.T, path string) {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}, "second\n"},
+		{"directory not writable", func(t *testing.T, path string) {
+			dir := filepath.Dir(path)
+			if err := os.Chmod(dir, 0555); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chmod(dir, 0755) })
+			if f, err := os.CreateTemp(dir, "probe"); err == nil {
+				f.Close()
+				os.Remove(f.Name())
+				t.Skip("permissions not enforced")
+			}
+		}, "first\nsecond\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "agent.log")
+			r, err := OpenRotating(path, 0, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			r.maxSize = 10
+
+			if _, err := r.Write([]byte("first\n")); err != nil {
+				t.Fatal(err)
+			}
+			tt.breakPath(t, path)
+
+			n, err := r.Write([]byte("second\n"))
+			if err == nil || !strings.Contains(err.Error(), "rotate log file") {
+				t.Errorf("err = %v, want a rotate error", err)
+			}
+			if n != len("second\n") {
+				t.Errorf("wrote %d bytes, want the line kept in the reopened file", n)
+			}
+			if active, _ := readLog(t, r); active != tt.wantActive {
+				t.Errorf("active = %q, want %q", active, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestStartTime(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.log")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	rotated := modTime.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name    string
+		content string
+		backups []time.Time
+		want    time.Time // Zero for about now
+	}{
+		{"empty", "", nil, time.Time{}},
+		{"no backups", "line\n", nil, modTime},
+		{"after last rotation", "line\n", []time.Time{rotated.Add(-24 * time.Hour), rotated}, rotated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				os.Remove(filepath.Join(dir, e.Name()))
+			}
+			for _, at := range tt.backups {
+				name := "agent-" + at.Format(backupTimeFormat) + ".log"
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+
+			r := &RotatingFile{path: path}
+			if err := r.open(); err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if tt.want.IsZero() {
+				if time.Since(r.started) > time.Minute {
+					t.Errorf("started = %v, want about now", r.started)
+				}
+			} else if !r.started.Equal(tt.want) {
+				t.Errorf("started = %v, want %v", r.started, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package otlp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+	"github.com/dkd/claude-insights-agent/internal/pricing"
+)
+
+// ScopeName identifies the agent as instrumentation scope
+const ScopeName = "github.com/dkd/claude-insights-agent"
+
+// Trace and span IDs are derived from the session ID, so exporting a
+// session twice yields the same IDs and backends can deduplicate them.
+
+// TraceID returns the trace ID of a session
+func TraceID(sessionID string) string {
+	sum := sha256.Sum256([]byte("trace/" + sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// spanID returns the ID of a span within a session
+func spanID(sessionID, kind string, n int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("span/%s/%s/%d", sessionID, kind, n)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Traces turns sessions into one trace each: a root span for the session,
+// a child span per message and a span per tool call below the message
+// that made it
+func Traces(sessions []*parser.Session, resource Resource) *TracesRequest {
+	var spans []Span
+	for _, s := range sessions {
+		spans = append(spans, sessionSpans(s)...)
+	}
+	return &TracesRequest{ResourceSpans: []ResourceSpans{{
+		Resource:   resource,
+		ScopeSpans: []ScopeSpans{{Scope: Scope{Name: ScopeName}, Spans: spans}},
+	}}}
+}
+
+// messageInfo collects what is known about one message sequence number.
+// At share level metadata only token usage is present.
+type messageInfo struct {
+	seq   int
+	at    time.Time
+	role  string
+	usage *parser.TokenUsageItem
+}
+
+func sessionSpans(s *parser.Session) []Span {
+	traceID := TraceID(s.ID)
+	rootID := spanID(s.ID, "session", 0)
+	start, end := sessionBounds(s)
+
+	rootAttrs := []KeyValue{
+		String("session.id", s.ID),
+		String("claude.project", s.ProjectName),
+		Int("claude.messages", s.TotalMessages),
+		Int("gen_ai.usage.input_tokens", s.TotalTokensIn),
+		Int("gen_ai.usage.output_tokens", s.TotalTokensOut),
+		Int("claude.usage.cache_read_tokens", s.TotalCacheRead),
+		Int("claude.usage.cache_creation_tokens", s.TotalCacheWrite),
+		Float("claude.cache_hit_ratio", s.CacheHitRatio),
+		Float("claude.cost_usd", SessionCost(s)),
+		Int("claude.active_seconds", s.ActiveSeconds),
+	}
+	if s.Model != "" {
+		rootAttrs = append(rootAttrs, String("gen_ai.request.model", s.Model))
+	}
+	spans := []Span{{
+		TraceID:           traceID,
+		SpanID:            rootID,
+		Name:              "claude.session",
+		Kind:              SpanKindInternal,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(end),
+		Attributes:        rootAttrs,
+	}}
+
+	// Merge messages and token usage by sequence number
+	bySeq := make(map[int]*messageInfo)
+	info := func(seq int) *messageInfo {
+		if bySeq[seq] == nil {
+			bySeq[seq] = &messageInfo{seq: seq}
+		}
+		return bySeq[seq]
+	}
+	for _, m := range s.Messages {
+		mi := info(m.Seq)
+		mi.at, mi.role = m.Timestamp, m.Role
+	}
+	for i := range s.TokenUsage {
+		u := &s.TokenUsage[i]
+		mi := info(u.MessageSeq)
+		mi.usage = u
+		if mi.at.IsZero() {
+			mi.at = u.Timestamp
+		}
+		if mi.role == "" {
+			mi.role = "assistant"
+		}
+	}
+	messages := make([]*messageInfo, 0, len(bySeq))
+	for _, mi := range bySeq {
+		if mi.at.IsZero() {
+			mi.at = start
+		}
+		messages = append(messages, mi)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].seq < messages[j].seq })
+
+	// A message lasts until the next one starts
+	for i, mi := range messages {
+		msgEnd := mi.at
+		if i+1 < len(messages) && messages[i+1].at.After(mi.at) {
+			msgEnd = messages[i+1].at
+		}
+
+		attrs := []KeyValue{
+			Int("claude.message.seq", mi.seq),
+			String("claude.message.role", mi.role),
+		}
+		if u := mi.usage; u != nil {
+			attrs = append(attrs,
+				String("gen_ai.response.model", u.Model),
+				Int("gen_ai.usage.input_tokens", u.InputTokens),
+				Int("gen_ai.usage.output_tokens", u.OutputTokens),
+				Int("claude.usage.cache_read_tokens", u.CacheReadTokens),
+				Int("claude.usage.cache_creation_tokens", u.CacheCreationTokens),
+				Float("claude.cost_usd", pricing.Cost(u.Model, u.InputTokens, u.OutputTokens, u.CacheReadTokens, u.CacheCreationTokens)),
+			)
+		}
+		spans = append(spans, Span{
+			TraceID:           traceID,
+			SpanID:            spanID(s.ID, "message", mi.seq),
+			ParentSpanID:      rootID,
+			Name:              "claude.message",
+			Kind:              SpanKindInternal,
+			StartTimeUnixNano: unixNano(mi.at),
+			EndTimeUnixNano:   unixNano(msgEnd),
+			Attributes:        attrs,
+		})
+	}
+
+	// Tool calls hang below the message that made them
+	for i, tc := range s.ToolCalls {
+		parent, at := rootID, start
+		if mi := bySeq[tc.MessageSeq]; mi != nil {
+			parent, at = spanID(s.ID, "message", mi.seq), mi.at
+		}
+
+		span := Span{
+			TraceID:           traceID,
+			SpanID:            spanID(s.ID, "tool", i),
+			ParentSpanID:      parent,
+			Name:              "execute_tool " + tc.ToolName,
+			Kind:              SpanKindInternal,
+			StartTimeUnixNano: unixNano(at),
+			EndTimeUnixNano:   unixNano(at.Add(time.Duration(tc.DurationMs) * time.Millisecond)),
+			Attributes: []KeyValue{
+				String("gen_ai.tool.name", tc.ToolName),
+				Bool("claude.tool.success", tc.Success),
+			},
+		}
+		if !tc.Success {
+			span.Status = &Status{Code: StatusError, Message: "tool call failed"}
+		}
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+// sessionBounds returns the start and end of a session, falling back to
+// the last message or token usage when the end is unknown
+func sessionBounds(s *parser.Session) (time.Time, time.Time) {
+	start := s.StartedAt
+	if s.EndedAt != nil {
+		return start, *s.EndedAt
+	}
+	end := start
+	for _, m := range s.Messages {
+		if m.Timestamp.After(end) {
+			end = m.Timestamp
+		}
+	}
+	for _, u := range s.TokenUsage {
+		if u.Timestamp.After(end) {
+			end = u.Timestamp
+		}
+	}
+	return start, end
+}
+
+// SessionCost returns the estimated USD cost of a session across its models
+func SessionCost(s *parser.Session) float64 {
+	var cost float64
+	for model, m := range s.Models {
+		cost += pricing.Cost(model, m.InputTokens, m.OutputTokens, m.CacheReadTokens, m.CacheCreationTokens)
+	}
+	return cost
+}
+
+// Metrics reports token usage and cost per model and tool calls and
+// errors per tool as delta sums, one data point per session and series
+func Metrics(sessions []*parser.Session, resource Resource) *MetricsRequest {
+	tokens := Metric{Name: "claude.tokens", Description: "Tokens used", Unit: "{token}", Sum: newSum()}
+	cost := Metric{Name: "claude.cost", Description: "Estimated cost at list prices", Unit: "USD", Sum: newSum()}
+	calls := Metric{Name: "claude.tool.calls", Description: "Tool calls", Unit: "{call}", Sum: newSum()}
+	errors := Metric{Name: "claude.tool.errors", Description: "Failed tool calls", Unit: "{error}", Sum: newSum()}
+
+	for _, s := range sessions {
+		start, end := sessionBounds(s)
+		point := func(attrs ...KeyValue) NumberDataPoint {
+			// Session IDs are left out to keep metric cardinality low
+			attrs = append([]KeyValue{String("claude.project", s.ProjectName)}, attrs...)
+			return NumberDataPoint{Attributes: attrs, StartTimeUnixNano: unixNano(start), TimeUnixNano: unixNano(end)}
+		}
+		intPoint := func(n int, attrs ...KeyValue) NumberDataPoint {
+			p := point(attrs...)
+			v := fmt.Sprint(n)
+			p.AsInt = &v
+			return p
+		}
+
+		for _, model := range sortedKeys(s.Models) {
+			m := s.Models[model]
+			modelAttr := String("gen_ai.request.model", model)
+			for _, t := range []struct {
+				kind string
+				n    int
+			}{
+				{"input", m.InputTokens},
+				{"output", m.OutputTokens},
+				{"cache_read", m.CacheReadTokens},
+				{"cache_creation", m.CacheCreationTokens},
+			} {
+				tokens.Sum.DataPoints = append(tokens.Sum.DataPoints, intPoint(t.n, modelAttr, String("gen_ai.token.type", t.kind)))
+			}
+
+			p := point(modelAttr)
+			c := pricing.Cost(model, m.InputTokens, m.OutputTokens, m.CacheReadTokens, m.CacheCreationTokens)
+			p.AsDouble = &c
+			cost.Sum.DataPoints = append(cost.Sum.DataPoints, p)
+		}
+
+		for _, tool := range sortedKeys(s.Tools) {
+			t := s.Tools[tool]
+			toolAttr := String("gen_ai.tool.name", tool)
+			calls.Sum.DataPoints = append(calls.Sum.DataPoints, intPoint(t.Count, toolAttr))
+			errors.Sum.DataPoints = append(errors.Sum.DataPoints, intPoint(t.Errors, toolAttr))
+		}
+	}
+
+	return &MetricsRequest{ResourceMetrics: []ResourceMetrics{{
+		Resource: resource,
+		ScopeMetrics: []ScopeMetrics{{
+			Scope:   Scope{Name: ScopeName},
+			Metrics: []Metric{tokens, cost, calls, errors},
+		}},
+	}}}
+}
+
+func newSum() *Sum {
+	return &Sum{AggregationTemporality: AggregationTemporalityDelta, IsMonotonic: true}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,216 @@
+package otlp_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/otlp"
+	"github.com/dkd/claude-insights-agent/internal/otlp/fakecollector"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+var (
+	traceIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	spanIDRe  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// testSession has two messages, token usage on the second and tool calls
+// made by it and by an unknown message
+func testSession(id string) *parser.Session {
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	return &parser.Session{
+		ID:          id,
+		ProjectName: "app",
+		StartedAt:   start,
+		Messages: []parser.Message{
+			{Seq: 1, Timestamp: start, Role: "user"},
+			{Seq: 2, Timestamp: start.Add(time.Second), Role: "assistant"},
+		},
+		TokenUsage: []parser.TokenUsageItem{
+			{MessageSeq: 2, Timestamp: start.Add(time.Second), Model: "claude-sonnet-4", InputTokens: 1234567890123, OutputTokens: 20},
+		},
+		ToolCalls: []parser.ToolCallItem{
+			{MessageSeq: 2, ToolName: "Bash", DurationMs: 1500, Success: true},
+			{MessageSeq: 99, ToolName: "Read", Success: false},
+		},
+		Models: map[string]*parser.ModelStats{
+			"claude-sonnet-4": {InputTokens: 1234567890123, OutputTokens: 20},
+		},
+		Tools: map[string]*parser.ToolStats{
+			"Bash": {Count: 1},
+			"Read": {Count: 1, Errors: 1},
+		},
+	}
+}
+
+// export sends sessions to a fake collector and returns it
+func export(t *testing.T, sessions ...*parser.Session) *fakecollector.Collector {
+	t.Helper()
+	c := fakecollector.New()
+	t.Cleanup(c.Close)
+	e := otlp.NewExporter(c.URL, nil)
+	resource := otlp.Resource{Attributes: []otlp.KeyValue{otlp.String("service.name", "test")}}
+	if _, err := e.ExportTraces(otlp.Traces(sessions, resource)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ExportMetrics(otlp.Metrics(sessions, resource)); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTraces(t *testing.T) {
+	spans := export(t, testSession("s1")).Spans()
+	byName := make(map[string]otlp.Span)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	root := byName["claude.session"]
+
+	tests := []struct {
+		name       string
+		wantParent string // Name of the parent span, empty for the root
+	}{
+		{"claude.session", ""},
+		{"execute_tool Bash", "claude.message"},
+		{"execute_tool Read", "claude.session"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, ok := byName[tt.name]
+			if !ok {
+				t.Fatalf("span %q missing from %d spans", tt.name, len(spans))
+			}
+			if span.TraceID != otlp.TraceID("s1") || !traceIDRe.MatchString(span.TraceID) {
+				t.Errorf("trace ID = %q", span.TraceID)
+			}
+			if !spanIDRe.MatchString(span.SpanID) {
+				t.Errorf("span ID = %q", span.SpanID)
+			}
+			if tt.wantParent == "" {
+				if span.ParentSpanID != "" {
+					t.Errorf("root has parent %q", span.ParentSpanID)
+				}
+				return
+			}
+			var parent otlp.Span
+			for _, s := range spans {
+				if s.SpanID == span.ParentSpanID {
+					parent = s
+				}
+			}
+			if parent.Name != tt.wantParent {
+				t.Errorf("parent = %q, want %q", parent.Name, tt.wantParent)
+			}
+		})
+	}
+
+	var messages int
+	seen := make(map[string]bool)
+	for _, s := range spans {
+		if seen[s.SpanID] {
+			t.Errorf("duplicate span ID %s", s.SpanID)
+		}
+		seen[s.SpanID] = true
+		if s.Name == "claude.message" {
+			messages++
+			if s.ParentSpanID != root.SpanID {
+				t.Errorf("message span parent = %q, want root %q", s.ParentSpanID, root.SpanID)
+			}
+		}
+	}
+	if messages != 2 {
+		t.Errorf("message spans = %d, want 2", messages)
+	}
+	if status := byName["execute_tool Read"].Status; status == nil || status.Code != otlp.StatusError {
+		t.Errorf("failed tool status = %+v", status)
+	}
+}
+
+func TestTraceIDsStable(t *testing.T) {
+	first := export(t, testSession("s1")).Spans()
+	second := export(t, testSession("s1")).Spans()
+	other := export(t, testSession("s2")).Spans()
+
+	if len(first) != len(second) {
+		t.Fatalf("span counts differ: %d, %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i].SpanID != second[i].SpanID || first[i].TraceID != second[i].TraceID {
+			t.Errorf("span %d: IDs changed between exports", i)
+		}
+	}
+	if other[0].TraceID == first[0].TraceID || other[0].SpanID == first[0].SpanID {
+		t.Error("different sessions share IDs")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := export(t, testSession("s1")).Metrics()
+	byName := make(map[string]otlp.Metric)
+	for _, m := range metrics {
+		byName[m.Name] = m
+	}
+
+	tests := []struct {
+		metric string
+		attr   string // Value of the distinguishing attribute
+		want   string // AsInt, as sent
+	}{
+		{"claude.tokens", "input", "1234567890123"},
+		{"claude.tokens", "output", "20"},
+		{"claude.tool.calls", "Bash", "1"},
+		{"claude.tool.errors", "Read", "1"},
+		{"claude.tool.errors", "Bash", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric+"/"+tt.attr, func(t *testing.T) {
+			m := byName[tt.metric]
+			if m.Sum == nil || m.Sum.AggregationTemporality != otlp.AggregationTemporalityDelta || !m.Sum.IsMonotonic {
+				t.Fatalf("metric %s sum = %+v", tt.metric, m.Sum)
+			}
+			for _, p := range m.Sum.DataPoints {
+				if !hasAttr(p.Attributes, tt.attr) {
+					continue
+				}
+				if p.AsInt == nil || *p.AsInt != tt.want {
+					t.Errorf("asInt = %v, want %q", p.AsInt, tt.want)
+				}
+				return
+			}
+			t.Errorf("no data point with %q", tt.attr)
+		})
+	}
+
+	cost := byName["claude.cost"]
+	if len(cost.Sum.DataPoints) != 1 || cost.Sum.DataPoints[0].AsDouble == nil || cost.Sum.DataPoints[0].AsInt != nil {
+		t.Errorf("cost data points = %+v", cost.Sum.DataPoints)
+	}
+}
+
+// TestMetricsIntAsString checks that 64-bit values are encoded as JSON
+// strings, as the OTLP JSON mapping requires
+func TestMetricsIntAsString(t *testing.T) {
+	data, err := json.Marshal(otlp.Metrics([]*parser.Session{testSession("s1")}, otlp.Resource{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"asInt":"1234567890123"`) {
+		t.Errorf("asInt not a string in %s", data)
+	}
+	if strings.Contains(string(data), `"asInt":1`) {
+		t.Errorf("asInt sent as a number in %s", data)
+	}
+}
+
+func hasAttr(attrs []otlp.KeyValue, value string) bool {
+	for _, a := range attrs {
+		if a.Value.StringValue != nil && *a.Value.StringValue == value {
+			return true
+		}
+	}
+	return false
+}
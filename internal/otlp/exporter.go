@@ -0,0 +1,101 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+)
+
+// OTLP/HTTP paths below the collector endpoint
+const (
+	TracesPath  = "/v1/traces"
+	MetricsPath = "/v1/metrics"
+)
+
+// Exporter sends OTLP/HTTP JSON requests to a collector. Errors are
+// *client.APIError values classified like those of the insights server.
+type Exporter struct {
+	endpoint   string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+// NewExporter creates an exporter for the collector at endpoint, e.g.
+// http://localhost:4318, sending headers with every request
+func NewExporter(endpoint string, headers map[string]string) *Exporter {
+	return &Exporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		headers:  headers,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// ExportTraces sends spans and returns the collector's partial success
+// report, if any
+func (e *Exporter) ExportTraces(req *TracesRequest) (*PartialSuccess, error) {
+	return e.post(TracesPath, req)
+}
+
+// ExportMetrics sends metrics and returns the collector's partial success
+// report, if any
+func (e *Exporter) ExportMetrics(req *MetricsRequest) (*PartialSuccess, error) {
+	return e.post(MetricsPath, req)
+}
+
+// post sends a gzip-compressed JSON export request
+func (e *Exporter) post(path string, payload any) (*PartialSuccess, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payload: %w", err)
+	}
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("compress payload: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint+path, &body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, client.TransportError("send request", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, client.TransportError("read response", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, client.ResponseError(resp, respBody)
+	}
+
+	var result ExportResponse
+	if len(bytes.TrimSpace(respBody)) > 0 {
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("parse response: %w", err)
+		}
+	}
+	return result.PartialSuccess, nil
+}
@@ -0,0 +1,146 @@
+// Package fakecollector is an in-memory stand-in for an OpenTelemetry
+// collector's OTLP/HTTP JSON receiver, used to exercise the exporter
+// locally.
+package fakecollector
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/dkd/claude-insights-agent/internal/otlp"
+)
+
+// Collector records every export request it receives
+type Collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures []failure
+	traces   []*otlp.TracesRequest
+	metrics  []*otlp.MetricsRequest
+}
+
+// failure is an injected error response for requests to path, or to any
+// path if empty
+type failure struct {
+	path   string
+	status int
+}
+
+// New starts a fake collector
+func New() *Collector {
+	c := &Collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.handle))
+	return c
+}
+
+// FailNext makes the next export request fail with the given status.
+// Calls queue up.
+func (c *Collector) FailNext(status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, failure{status: status})
+}
+
+// FailNextAt makes the next export request to path, such as
+// otlp.TracesPath, fail with the given status. Calls queue up.
+func (c *Collector) FailNextAt(path string, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, failure{path: path, status: status})
+}
+
+// Spans returns all received spans in order of arrival
+func (c *Collector) Spans() []otlp.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var spans []otlp.Span
+	for _, req := range c.traces {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+// Metrics returns all received metrics in order of arrival
+func (c *Collector) Metrics() []otlp.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var metrics []otlp.Metric
+	for _, req := range c.metrics {
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				metrics = append(metrics, sm.Metrics...)
+			}
+		}
+	}
+	return metrics
+}
+
+func (c *Collector) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mu.Lock()
+	for i, f := range c.failures {
+		if f.path == "" || f.path == r.URL.Path {
+			c.failures = append(c.failures[:i], c.failures[i+1:]...)
+			c.mu.Unlock()
+			http.Error(w, fmt.Sprintf(`{"message":"injected failure %d"}`, f.status), f.status)
+			return
+		}
+	}
+	c.mu.Unlock()
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+
+	switch r.URL.Path {
+	case otlp.TracesPath:
+		var req otlp.TracesRequest
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.traces = append(c.traces, &req)
+		c.mu.Unlock()
+
+	case otlp.MetricsPath:
+		var req otlp.MetricsRequest
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.metrics = append(c.metrics, &req)
+		c.mu.Unlock()
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
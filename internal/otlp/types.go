@@ -0,0 +1,186 @@
+// Package otlp exports sessions to an OpenTelemetry collector over
+// OTLP/HTTP with JSON encoding.
+package otlp
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// The types below mirror the OTLP protobuf messages in their JSON mapping:
+// camelCase field names, hex trace and span IDs, and 64-bit integers as
+// decimal strings.
+
+// TracesRequest is an ExportTraceServiceRequest
+type TracesRequest struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+// MetricsRequest is an ExportMetricsServiceRequest
+type MetricsRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+// ResourceSpans groups spans by the resource that produced them
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+// ResourceMetrics groups metrics by the resource that produced them
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+// Resource describes the entity producing telemetry
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// Scope is the instrumentation scope
+type Scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// ScopeSpans groups spans by instrumentation scope
+type ScopeSpans struct {
+	Scope Scope  `json:"scope"`
+	Spans []Span `json:"spans"`
+}
+
+// ScopeMetrics groups metrics by instrumentation scope
+type ScopeMetrics struct {
+	Scope   Scope    `json:"scope"`
+	Metrics []Metric `json:"metrics"`
+}
+
+// Span kinds and status codes
+const (
+	SpanKindInternal = 1
+
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Span is a single operation within a trace
+type Span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            *Status    `json:"status,omitempty"`
+}
+
+// Status is the outcome of a span
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// AggregationTemporalityDelta marks sums reported per interval rather than
+// since process start. Every session is exported once, so its totals are
+// deltas.
+const AggregationTemporalityDelta = 1
+
+// Metric is a named series of data points
+type Metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Sum         *Sum   `json:"sum,omitempty"`
+}
+
+// Sum is a metric whose data points add up
+type Sum struct {
+	DataPoints             []NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+// NumberDataPoint is a single int or double value
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             *string    `json:"asInt,omitempty"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+// KeyValue is an attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue holds exactly one attribute value
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// PartialSuccess is returned by collectors that accepted only part of a
+// request
+type PartialSuccess struct {
+	RejectedSpans      Int64  `json:"rejectedSpans,omitempty"`
+	RejectedDataPoints Int64  `json:"rejectedDataPoints,omitempty"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+// ExportResponse is the response to both trace and metric exports
+type ExportResponse struct {
+	PartialSuccess *PartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// Int64 decodes a 64-bit integer sent either as a number or as a string
+type Int64 int64
+
+func (n *Int64) UnmarshalJSON(data []byte) error {
+	if s, err := strconv.Unquote(string(data)); err == nil {
+		data = []byte(s)
+	}
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*n = Int64(v)
+	return nil
+}
+
+// String builds a string attribute
+func String(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: &value}}
+}
+
+// Int builds an integer attribute
+func Int(key string, value int) KeyValue {
+	s := strconv.Itoa(value)
+	return KeyValue{Key: key, Value: AnyValue{IntValue: &s}}
+}
+
+// Float builds a double attribute
+func Float(key string, value float64) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{DoubleValue: &value}}
+}
+
+// Bool builds a boolean attribute
+func Bool(key string, value bool) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{BoolValue: &value}}
+}
+
+// unixNano formats a time as OTLP nanoseconds since the epoch
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CommandCallItem represents a single slash command invocation
+type CommandCallItem struct {
+	MessageSeq int    `json:"message_sequence,omitempty"`
+	Name       string `json:"name"`
+	Args       string `json:"args,omitempty"`
+}
+
+var (
+	// Claude Code wraps expanded slash commands in these tags
+	commandNameRe = regexp.MustCompile(`(?s)<command-name>\s*(.*?)\s*</command-name>`)
+	commandArgsRe = regexp.MustCompile(`(?s)<command-args>\s*(.*?)\s*</command-args>`)
+
+	// Plain "/name args" typed as the first token of a message
+	plainCommandRe = regexp.MustCompile(`^/([a-z][a-z-]*)(?:\s+(.*))?$`)
+)
+
+// builtinCommands are the slash commands Claude Code ships with. Without
+// the command tags only these are recognized, so prompts that merely
+// start with a path, like "/tmp is full", are not taken for commands.
+var builtinCommands = map[string]bool{
+	"add-dir": true, "agents": true, "bug": true, "clear": true,
+	"compact": true, "config": true, "context": true, "cost": true,
+	"doctor": true, "exit": true, "export": true, "help": true,
+	"hooks": true, "ide": true, "init": true, "install-github-app": true,
+	"login": true, "logout": true, "mcp": true, "memory": true,
+	"model": true, "output-style": true, "permissions": true, "plugin": true,
+	"pr-comments": true, "release-notes": true, "resume": true, "review": true,
+	"rewind": true, "security-review": true, "status": true, "statusline": true,
+	"terminal-setup": true, "todos": true, "usage": true, "vim": true,
+}
+
+// parseCommand detects a slash command invocation in user message text.
+// It returns the command name without the leading slash and its arguments.
+func parseCommand(text string) (name, args string, ok bool) {
+	if m := commandNameRe.FindStringSubmatch(text); m != nil {
+		name = strings.TrimPrefix(strings.TrimSpace(m[1]), "/")
+		if name == "" {
+			return "", "", false
+		}
+		if a := commandArgsRe.FindStringSubmatch(text); a != nil {
+			args = a[1]
+		}
+		return name, args, true
+	}
+
+	text = strings.TrimSpace(text)
+	firstLine, rest, _ := strings.Cut(text, "\n")
+	m := plainCommandRe.FindStringSubmatch(strings.TrimSpace(firstLine))
+	if m == nil || !builtinCommands[m[1]] {
+		return "", "", false
+	}
+	args = strings.TrimSpace(m[2])
+	if rest != "" {
+		args = strings.TrimSpace(args + "\n" + rest)
+	}
+	return m[1], args, true
+}
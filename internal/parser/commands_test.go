@@ -0,0 +1,34 @@
+package parser
+
+import "testing"
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantName string
+		wantArgs string
+		wantOK   bool
+	}{
+		{"tagged", "<command-name>/review</command-name>\n<command-args>PR 12</command-args>", "review", "PR 12", true},
+		{"tagged custom", "<command-name>/deploy:staging</command-name>", "deploy:staging", "", true},
+		{"tagged empty", "<command-name> </command-name>", "", "", false},
+		{"plain builtin", "/compact", "compact", "", true},
+		{"plain builtin with args", "/model opus", "model", "opus", true},
+		{"plain builtin multiline", "/review focus on errors\nand tests", "review", "focus on errors\nand tests", true},
+		{"plain unknown", "/deploy now", "", "", false},
+		{"path prompt", "/tmp is full, why?", "", "", false},
+		{"nested path prompt", "/etc/hosts looks wrong", "", "", false},
+		{"builtin followed by path", "/init/foo", "", "", false},
+		{"prose", "please run the tests", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args, ok := parseCommand(tt.text)
+			if name != tt.wantName || args != tt.wantArgs || ok != tt.wantOK {
+				t.Errorf("parseCommand(%q) = %q, %q, %v; want %q, %q, %v",
+					tt.text, name, args, ok, tt.wantName, tt.wantArgs, tt.wantOK)
+			}
+		})
+	}
+}
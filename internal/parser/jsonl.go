@@ -11,20 +11,35 @@ import (
 
 // Session represents a parsed Claude Code session
 type Session struct {
-	ID             string               `json:"session_id"`
-	ProjectName    string               `json:"project_name"`
-	ProjectPath    string               `json:"-"` // Not sent to server
-	StartedAt      time.Time            `json:"started_at"`
-	EndedAt        *time.Time           `json:"ended_at,omitempty"`
-	TotalMessages  int                  `json:"total_messages"`
-	TotalTokensIn  int                  `json:"total_tokens_in"`
-	TotalTokensOut int                  `json:"total_tokens_out"`
-	Model          string               `json:"model,omitempty"`
-	Tools          map[string]*ToolStats `json:"tools"`
-	Tags           []string             `json:"tags"`
-	Messages       []Message            `json:"messages,omitempty"`
-	TokenUsage     []TokenUsageItem     `json:"token_usage"`
-	ToolCalls      []ToolCallItem       `json:"tool_calls"`
+	ID                string                 `json:"session_id"`
+	ProjectName       string                 `json:"project_name"`
+	ProjectPath       string                 `json:"-"`                // Not sent to server
+	Source            string                 `json:"source,omitempty"` // Label of the Claude data directory
+	StartedAt         time.Time              `json:"started_at"`
+	EndedAt           *time.Time             `json:"ended_at,omitempty"`
+	TotalMessages     int                    `json:"total_messages"`
+	TotalTokensIn     int                    `json:"total_tokens_in"` // Uncached input only
+	TotalTokensOut    int                    `json:"total_tokens_out"`
+	TotalCacheRead    int                    `json:"total_cache_read_tokens"`
+	TotalCacheWrite   int                    `json:"total_cache_creation_tokens"`
+	EffectiveTokensIn int                    `json:"effective_tokens_in"` // Input plus cache reads and writes
+	CacheHitRatio     float64                `json:"cache_hit_ratio"`     // Cache reads / effective input
+	Model             string                 `json:"model,omitempty"`     // Primary model by output tokens
+	Models            map[string]*ModelStats `json:"models"`
+	Tools             map[string]*ToolStats  `json:"tools"`
+	Tags              []string               `json:"tags"`
+	Messages          []Message              `json:"messages,omitempty"`
+	TokenUsage        []TokenUsageItem       `json:"token_usage"`
+	ToolCalls         []ToolCallItem         `json:"tool_calls"`
+	Commands          map[string]int         `json:"commands"`
+	CommandCalls      []CommandCallItem      `json:"command_calls,omitempty"`
+	ActiveSeconds     int                    `json:"active_seconds"` // Excludes idle gaps
+	IdleGaps          int                    `json:"idle_gaps"`
+	IdleSeconds       int                    `json:"idle_seconds"`
+	AvgResponseMs     int64                  `json:"avg_response_ms"`
+	AvgThinkMs        int64                  `json:"avg_think_ms"`
+	Turns             []TurnTiming           `json:"turns"`
+	Todos             *TodoList              `json:"todos,omitempty"`
 }
 
 type ToolStats struct {
@@ -33,6 +48,15 @@ type ToolStats struct {
 	Errors  int `json:"errors"`
 }
 
+// ModelStats aggregates usage for a single model within a session
+type ModelStats struct {
+	Messages            int `json:"messages"`
+	InputTokens         int `json:"input_tokens"`
+	OutputTokens        int `json:"output_tokens"`
+	CacheReadTokens     int `json:"cache_read_tokens"`
+	CacheCreationTokens int `json:"cache_creation_tokens"`
+}
+
 type Message struct {
 	Seq       int       `json:"seq"`
 	Timestamp time.Time `json:"timestamp,omitempty"`
@@ -91,8 +115,28 @@ type Usage struct {
 	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
 }
 
-// ParseJSONL parses a JSONL session file
+// Options controls how session files are parsed
+type Options struct {
+	IdleThreshold time.Duration
+	TodosDir      string // Directory with per-session todo files, optional
+}
+
+// DefaultOptions returns the options used by ParseJSONL
+func DefaultOptions() Options {
+	return Options{IdleThreshold: DefaultIdleThreshold}
+}
+
+// ParseJSONL parses a JSONL session file with default options
 func ParseJSONL(path string) (*Session, error) {
+	return ParseJSONLWithOptions(path, DefaultOptions())
+}
+
+// ParseJSONLWithOptions parses a JSONL session file
+func ParseJSONLWithOptions(path string, opts Options) (*Session, error) {
+	if opts.IdleThreshold <= 0 {
+		opts.IdleThreshold = DefaultIdleThreshold
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -102,20 +146,15 @@ func ParseJSONL(path string) (*Session, error) {
 	session := &Session{
 		ID:         filepath.Base(strings.TrimSuffix(path, ".jsonl")),
 		Tools:      make(map[string]*ToolStats),
+		Models:     make(map[string]*ModelStats),
 		Tags:       []string{},
 		TokenUsage: []TokenUsageItem{},
 		ToolCalls:  []ToolCallItem{},
+		Commands:   make(map[string]int),
 	}
 
 	// Extract project path from parent directory
-	parentDir := filepath.Base(filepath.Dir(path))
-	if strings.HasPrefix(parentDir, "-") {
-		session.ProjectPath = strings.ReplaceAll(parentDir, "-", "/")
-		parts := strings.Split(session.ProjectPath, "/")
-		if len(parts) > 0 {
-			session.ProjectName = parts[len(parts)-1]
-		}
-	}
+	session.ProjectPath, session.ProjectName = projectFromSessionPath(path)
 
 	scanner := bufio.NewScanner(file)
 	// Increase buffer size for large lines
@@ -123,6 +162,8 @@ func ParseJSONL(path string) (*Session, error) {
 	scanner.Buffer(buf, 10*1024*1024)
 
 	var firstTs, lastTs time.Time
+	var timeline []timelineEvent
+	todoUpdates := 0
 	msgSeq := 0
 
 	for scanner.Scan() {
@@ -162,11 +203,14 @@ func ParseJSONL(path string) (*Session, error) {
 			// Extract text and tool usage
 			// Content can be either a string (user messages) or array of blocks (assistant)
 			var textParts []string
+			var promptParts []string // Text typed by the user, excluding tool results
+			hasToolResult := false
 			if len(msgContent.Content) > 0 {
 				// Try parsing as string first (user messages)
 				var contentStr string
 				if err := json.Unmarshal(msgContent.Content, &contentStr); err == nil {
 					textParts = append(textParts, contentStr)
+					promptParts = append(promptParts, contentStr)
 				} else {
 					// Parse as array of content blocks (assistant messages)
 					var blocks []ContentBlock
@@ -175,8 +219,10 @@ func ParseJSONL(path string) (*Session, error) {
 							switch block.Type {
 							case "text":
 								textParts = append(textParts, block.Text)
+								promptParts = append(promptParts, block.Text)
 							case "tool_result":
 								// Tool results contain user responses and tool outputs
+								hasToolResult = true
 								if block.Content != "" {
 									textParts = append(textParts, block.Content)
 								}
@@ -201,6 +247,14 @@ func ParseJSONL(path string) (*Session, error) {
 										ToolInput:  toolInput,
 										Success:    true,
 									})
+
+									// Track the latest todo list
+									if block.Name == "TodoWrite" {
+										if todos, ok := parseTodoWrite(block.Input); ok {
+											todoUpdates++
+											session.Todos = todos
+										}
+									}
 								}
 							}
 						}
@@ -208,10 +262,24 @@ func ParseJSONL(path string) (*Session, error) {
 				}
 			}
 
+			// Detect slash command invocations in user prompts
+			if entry.Type == "user" {
+				if name, args, ok := parseCommand(strings.Join(promptParts, "\n")); ok {
+					session.Commands[name]++
+					session.CommandCalls = append(session.CommandCalls, CommandCallItem{
+						MessageSeq: msgSeq,
+						Name:       name,
+						Args:       args,
+					})
+				}
+			}
+
 			// Track tokens and model
 			if msgContent.Usage != nil {
 				session.TotalTokensIn += msgContent.Usage.InputTokens
 				session.TotalTokensOut += msgContent.Usage.OutputTokens
+				session.TotalCacheRead += msgContent.Usage.CacheReadInputTokens
+				session.TotalCacheWrite += msgContent.Usage.CacheCreationInputTokens
 
 				// Collect detailed token usage per message
 				session.TokenUsage = append(session.TokenUsage, TokenUsageItem{
@@ -225,9 +293,26 @@ func ParseJSONL(path string) (*Session, error) {
 				})
 			}
 			if msgContent.Model != "" {
-				session.Model = msgContent.Model
+				if session.Models[msgContent.Model] == nil {
+					session.Models[msgContent.Model] = &ModelStats{}
+				}
+				stats := session.Models[msgContent.Model]
+				stats.Messages++
+				if msgContent.Usage != nil {
+					stats.InputTokens += msgContent.Usage.InputTokens
+					stats.OutputTokens += msgContent.Usage.OutputTokens
+					stats.CacheReadTokens += msgContent.Usage.CacheReadInputTokens
+					stats.CacheCreationTokens += msgContent.Usage.CacheCreationInputTokens
+				}
 			}
 
+			timeline = append(timeline, timelineEvent{
+				seq:    msgSeq,
+				ts:     msgTs,
+				role:   entry.Type,
+				prompt: entry.Type == "user" && !hasToolResult && len(promptParts) > 0,
+			})
+
 			// Store message
 			ts := msgTs
 			session.Messages = append(session.Messages, Message{
@@ -247,12 +332,58 @@ func ParseJSONL(path string) (*Session, error) {
 		session.EndedAt = &lastTs
 	}
 
+	// Fall back to the todos directory when the transcript has no TodoWrite calls
+	if session.Todos == nil && opts.TodosDir != "" {
+		if todos, err := ParseTodos(opts.TodosDir, session.ID); err == nil && todos != nil && todos.Total > 0 {
+			session.Todos = todos
+		}
+	}
+	if session.Todos != nil {
+		session.Todos.Updates = todoUpdates
+	}
+
+	session.EffectiveTokensIn = session.TotalTokensIn + session.TotalCacheRead + session.TotalCacheWrite
+	if session.EffectiveTokensIn > 0 {
+		session.CacheHitRatio = float64(session.TotalCacheRead) / float64(session.EffectiveTokensIn)
+	}
+	session.Model = primaryModel(session.Models)
+	computeTiming(session, timeline, opts.IdleThreshold)
+
 	// Auto-generate tags
 	session.Tags = generateTags(session)
 
 	return session, scanner.Err()
 }
 
+// projectFromSessionPath derives the project path and name from the
+// encoded parent directory of a session file (-path-to-project)
+func projectFromSessionPath(path string) (projectPath, projectName string) {
+	parentDir := filepath.Base(filepath.Dir(path))
+	if !strings.HasPrefix(parentDir, "-") {
+		return "", ""
+	}
+	projectPath = strings.ReplaceAll(parentDir, "-", "/")
+	parts := strings.Split(projectPath, "/")
+	return projectPath, parts[len(parts)-1]
+}
+
+// primaryModel picks the model that produced the most output tokens,
+// falling back to message count and then name for a stable result
+func primaryModel(models map[string]*ModelStats) string {
+	primary := ""
+	var best *ModelStats
+	for name, stats := range models {
+		switch {
+		case best == nil,
+			stats.OutputTokens > best.OutputTokens,
+			stats.OutputTokens == best.OutputTokens && stats.Messages > best.Messages,
+			stats.OutputTokens == best.OutputTokens && stats.Messages == best.Messages && name < primary:
+			primary, best = name, stats
+		}
+	}
+	return primary
+}
+
 func generateTags(s *Session) []string {
 	tags := make([]string, 0)
 
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSession writes JSONL lines to a session file inside an encoded
+// project directory and returns its path
+func writeSession(t *testing.T, id string, lines ...string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "-home-u-proj")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, id+".jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// assistant returns an assistant entry with a model and token usage
+func assistant(model string, in, out, cacheRead, cacheWrite int) string {
+	return fmt.Sprintf(`{"type":"assistant","timestamp":"2026-01-01T10:00:05Z","message":{"model":%q,`+
+		`"usage":{"input_tokens":%d,"output_tokens":%d,"cache_read_input_tokens":%d,"cache_creation_input_tokens":%d},`+
+		`"content":[{"type":"text","text":"ok"}]}}`, model, in, out, cacheRead, cacheWrite)
+}
+
+func TestParseModels(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		wantPrimary string
+		wantModels  map[string]ModelStats
+	}{
+		{
+			name:        "no assistant messages",
+			lines:       []string{`{"type":"user","message":{"content":"hi"}}`},
+			wantPrimary: "",
+			wantModels:  map[string]ModelStats{},
+		},
+		{
+			name: "primary by output tokens, not messages",
+			lines: []string{
+				assistant("haiku", 10, 5, 0, 0),
+				assistant("haiku", 10, 5, 0, 0),
+				assistant("opus", 20, 100, 0, 0),
+			},
+			wantPrimary: "opus",
+			wantModels: map[string]ModelStats{
+				"haiku": {Messages: 2, InputTokens: 20, OutputTokens: 10},
+				"opus":  {Messages: 1, InputTokens: 20, OutputTokens: 100},
+			},
+		},
+		{
+			name: "tie on output broken by messages",
+			lines: []string{
+				assistant("a", 1, 10, 0, 0),
+				assistant("b", 1, 5, 0, 0),
+				assistant("b", 1, 5, 0, 0),
+			},
+			wantPrimary: "b",
+			wantModels: map[string]ModelStats{
+				"a": {Messages: 1, InputTokens: 1, OutputTokens: 10},
+				"b": {Messages: 2, InputTokens: 2, OutputTokens: 10},
+			},
+		},
+		{
+			name: "full tie broken by name",
+			lines: []string{
+				assistant("zeta", 1, 10, 0, 0),
+				assistant("alpha", 1, 10, 0, 0),
+			},
+			wantPrimary: "alpha",
+			wantModels: map[string]ModelStats{
+				"alpha": {Messages: 1, InputTokens: 1, OutputTokens: 10},
+				"zeta":  {Messages: 1, InputTokens: 1, OutputTokens: 10},
+			},
+		},
+		{
+			name:        "cache tokens attributed per model",
+			lines:       []string{assistant("opus", 1, 2, 300, 40)},
+			wantPrimary: "opus",
+			wantModels: map[string]ModelStats{
+				"opus": {Messages: 1, InputTokens: 1, OutputTokens: 2, CacheReadTokens: 300, CacheCreationTokens: 40},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseJSONL(writeSession(t, "s1", tt.lines...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Model != tt.wantPrimary {
+				t.Errorf("primary model = %q, want %q", s.Model, tt.wantPrimary)
+			}
+			if len(s.Models) != len(tt.wantModels) {
+				t.Fatalf("got %d models, want %d", len(s.Models), len(tt.wantModels))
+			}
+			for name, want := range tt.wantModels {
+				got := s.Models[name]
+				if got == nil || *got != want {
+					t.Errorf("model %s = %+v, want %+v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCacheTotals(t *testing.T) {
+	tests := []struct {
+		name          string
+		lines         []string
+		wantRead      int
+		wantWrite     int
+		wantEffective int
+		wantRatio     float64
+	}{
+		{
+			name:  "no usage",
+			lines: []string{`{"type":"user","message":{"content":"hi"}}`},
+		},
+		{
+			name:          "no cache",
+			lines:         []string{assistant("m", 100, 10, 0, 0)},
+			wantEffective: 100,
+		},
+		{
+			name: "reads and writes across messages",
+			lines: []string{
+				assistant("m", 10, 1, 0, 290),
+				assistant("m", 10, 1, 690, 0),
+			},
+			wantRead:      690,
+			wantWrite:     290,
+			wantEffective: 1000,
+			wantRatio:     0.69,
+		},
+		{
+			name:          "all cached",
+			lines:         []string{assistant("m", 0, 1, 500, 0)},
+			wantRead:      500,
+			wantEffective: 500,
+			wantRatio:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseJSONL(writeSession(t, "s1", tt.lines...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.TotalCacheRead != tt.wantRead || s.TotalCacheWrite != tt.wantWrite || s.EffectiveTokensIn != tt.wantEffective {
+				t.Errorf("cache read %d, write %d, effective %d; want %d, %d, %d",
+					s.TotalCacheRead, s.TotalCacheWrite, s.EffectiveTokensIn, tt.wantRead, tt.wantWrite, tt.wantEffective)
+			}
+			if diff := s.CacheHitRatio - tt.wantRatio; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("cache hit ratio = %v, want %v", s.CacheHitRatio, tt.wantRatio)
+			}
+		})
+	}
+}
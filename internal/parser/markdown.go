@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Section represents a heading and the sections nested below it
+type Section struct {
+	Level            int        `json:"level"`
+	Title            string     `json:"title"`
+	ChecklistTotal   int        `json:"checklist_total"`
+	ChecklistChecked int        `json:"checklist_checked"`
+	Children         []*Section `json:"children,omitempty"`
+}
+
+// ChecklistItem represents a markdown task list item
+type ChecklistItem struct {
+	Text    string `json:"text"`
+	Checked bool   `json:"checked"`
+	Section string `json:"section,omitempty"` // Title of the enclosing heading
+}
+
+var (
+	// Paths like src/main.go, ./cmd/agent, ~/.claude/plans/x.md, /etc/hosts
+	filePathRe = regexp.MustCompile(`(?:^|[\s(\x60"'])((?:~|\.{1,2})?/?(?:[\w.@-]+/)+[\w.@-]+)`)
+	// Bare file names in inline code, like `config.go`
+	inlineFileRe = regexp.MustCompile("\x60([\\w.-]+\\.[A-Za-z][A-Za-z0-9]{0,7})\x60")
+)
+
+// parseMarkdown fills the structural fields of a plan from its markdown
+func parseMarkdown(plan *Plan, content string) {
+	body := content
+	if fm, rest, ok := splitFrontmatter(content); ok {
+		var meta map[string]any
+		if err := yaml.Unmarshal([]byte(fm), &meta); err == nil && len(meta) > 0 {
+			plan.Frontmatter = meta
+		}
+		body = rest
+	}
+
+	var stack []*Section // Open sections, outermost first
+	seenFiles := make(map[string]bool)
+	titleFound := false
+	inCode := false
+
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		// Fenced code blocks
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			if !inCode {
+				plan.CodeBlocks++
+				lang := strings.ToLower(strings.Fields(trimmed[3:] + " _")[0])
+				if lang != "_" {
+					plan.CodeLanguages[lang]++
+				}
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+
+		// Headings
+		if level, title, ok := parseHeading(line); ok {
+			section := &Section{Level: level, Title: title}
+			for len(stack) > 0 && stack[len(stack)-1].Level >= level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				plan.Sections = append(plan.Sections, section)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, section)
+			}
+			stack = append(stack, section)
+
+			if !titleFound && level == 1 {
+				plan.Title = title
+				titleFound = true
+			}
+			continue
+		}
+
+		// Checklist items count towards every enclosing section
+		if checked, ok := parseChecklistItem(trimmed); ok {
+			item := ChecklistItem{Text: strings.TrimSpace(trimmed[5:]), Checked: checked}
+			if len(stack) > 0 {
+				item.Section = stack[len(stack)-1].Title
+			}
+			plan.Checklist = append(plan.Checklist, item)
+			plan.ChecklistTotal++
+			if checked {
+				plan.ChecklistChecked++
+			}
+			for _, s := range stack {
+				s.ChecklistTotal++
+				if checked {
+					s.ChecklistChecked++
+				}
+			}
+		}
+
+		// Referenced files
+		for _, path := range findFilePaths(line) {
+			if !seenFiles[path] {
+				seenFiles[path] = true
+				plan.Files = append(plan.Files, path)
+			}
+		}
+	}
+}
+
+// splitFrontmatter separates a leading YAML frontmatter block
+func splitFrontmatter(content string) (frontmatter, body string, ok bool) {
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return "", content, false
+	}
+	rest := content[strings.Index(content, "\n")+1:]
+	lines := strings.SplitAfter(rest, "\n")
+	offset := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "---" {
+			return rest[:offset], rest[offset+len(line):], true
+		}
+		offset += len(line)
+	}
+	return "", content, false
+}
+
+// parseHeading parses an ATX heading ("## Title")
+func parseHeading(line string) (level int, title string, ok bool) {
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(line) || line[level] != ' ' {
+		return 0, "", false
+	}
+	title = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	if title == "" {
+		return 0, "", false
+	}
+	return level, title, true
+}
+
+// parseChecklistItem reports whether a line is a markdown task list item
+// ("- [ ] step", "* [x] step") and whether it is checked
+func parseChecklistItem(line string) (checked, ok bool) {
+	if len(line) < 5 || (line[0] != '-' && line[0] != '*' && line[0] != '+') || line[1] != ' ' {
+		return false, false
+	}
+	switch line[2:5] {
+	case "[ ]":
+		return false, true
+	case "[x]", "[X]":
+		return true, true
+	}
+	return false, false
+}
+
+// findFilePaths extracts file paths referenced in a line of prose
+func findFilePaths(line string) []string {
+	var paths []string
+	for _, m := range filePathRe.FindAllStringSubmatch(line, -1) {
+		path := strings.TrimRight(m[1], ".,:;")
+		// Skip prose like "and/or" unless the path is anchored or has an extension
+		anchored := strings.HasPrefix(path, "/") || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, ".")
+		if !anchored && !strings.Contains(path[strings.LastIndex(path, "/")+1:], ".") {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	for _, m := range inlineFileRe.FindAllStringSubmatch(line, -1) {
+		paths = append(paths, m[1])
+	}
+	return paths
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// outline renders a section tree as "## title checked/total" lines,
+// indented by depth
+func outline(sections []*Section, depth int) string {
+	var b strings.Builder
+	for _, s := range sections {
+		b.WriteString(strings.Repeat("  ", depth))
+		fmt.Fprintf(&b, "%s %s %d/%d\n", strings.Repeat("#", s.Level), s.Title, s.ChecklistChecked, s.ChecklistTotal)
+		b.WriteString(outline(s.Children, depth+1))
+	}
+	return b.String()
+}
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		title       string
+		frontmatter map[string]any
+		outline     string
+		checklist   []ChecklistItem
+		codeBlocks  int
+		languages   map[string]int
+		files       []string
+	}{
+		{
+			name:    "no headings",
+			content: "just some text\n",
+			title:   "p",
+			outline: "",
+		},
+		{
+			name:    "first h1 is the title",
+			content: "## Intro\n# Plan A\n# Plan B\n",
+			title:   "Plan A",
+			outline: "## Intro 0/0\n# Plan A 0/0\n# Plan B 0/0\n",
+		},
+		{
+			name:    "nested sections",
+			content: "# Plan\n## Steps\n### Detail\n## Notes ##\n",
+			title:   "Plan",
+			outline: "# Plan 0/0\n  ## Steps 0/0\n    ### Detail 0/0\n  ## Notes 0/0\n",
+		},
+		{
+			name:    "not headings",
+			content: "#hashtag\n####### seven\n#   \n",
+			title:   "p",
+			outline: "",
+		},
+		{
+			name:    "checklist counts every enclosing section",
+			content: "# Plan\n## Steps\n- [x] one\n* [ ] two\n+ [X] three\n-[ ] not an item\n## Notes\n- [ ] four\n",
+			title:   "Plan",
+			outline: "# Plan 2/4\n  ## Steps 2/3\n  ## Notes 0/1\n",
+			checklist: []ChecklistItem{
+				{Text: "one", Checked: true, Section: "Steps"},
+				{Text: "two", Section: "Steps"},
+				{Text: "three", Checked: true, Section: "Steps"},
+				{Text: "four", Section: "Notes"},
+			},
+		},
+		{
+			name:        "frontmatter",
+			content:     "---\nstatus: draft\ntags: [a]\n---\n# Plan\n",
+			title:       "Plan",
+			frontmatter: map[string]any{"status": "draft", "tags": []any{"a"}},
+			outline:     "# Plan 0/0\n",
+		},
+		{
+			name:    "unterminated frontmatter is body",
+			content: "---\nstatus: draft\n# Plan\n",
+			title:   "Plan",
+			outline: "# Plan 0/0\n",
+		},
+		{
+			name:       "code blocks hide headings and items",
+			content:    "# Plan\n```go\n# not a heading\n- [ ] not an item\n```\n~~~\nplain\n~~~\n```Go\n```\n",
+			title:      "Plan",
+			outline:    "# Plan 0/0\n",
+			codeBlocks: 3,
+			languages:  map[string]int{"go": 2},
+		},
+		{
+			name:    "file references",
+			content: "Edit src/main.go and ./cmd/agent, then `config.go`.\nRead ~/.claude/plans/x.md and /etc/hosts. Not and/or.\nsrc/main.go again\n",
+			title:   "p",
+			outline: "",
+			files:   []string{"src/main.go", "./cmd/agent", "config.go", "~/.claude/plans/x.md", "/etc/hosts"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := ParsePlanContent("p", []byte(tt.content), time.Time{})
+
+			if plan.Title != tt.title {
+				t.Errorf("title = %q, want %q", plan.Title, tt.title)
+			}
+			if !reflect.DeepEqual(plan.Frontmatter, tt.frontmatter) {
+				t.Errorf("frontmatter = %v, want %v", plan.Frontmatter, tt.frontmatter)
+			}
+			if got := outline(plan.Sections, 0); got != tt.outline {
+				t.Errorf("sections:\n%s\nwant:\n%s", got, tt.outline)
+			}
+			if !reflect.DeepEqual(plan.Checklist, tt.checklist) {
+				t.Errorf("checklist = %+v, want %+v", plan.Checklist, tt.checklist)
+			}
+			checked := 0
+			for _, item := range tt.checklist {
+				if item.Checked {
+					checked++
+				}
+			}
+			if plan.ChecklistTotal != len(tt.checklist) || plan.ChecklistChecked != checked {
+				t.Errorf("checklist counts = %d/%d, want %d/%d", plan.ChecklistChecked, plan.ChecklistTotal, checked, len(tt.checklist))
+			}
+			if plan.CodeBlocks != tt.codeBlocks {
+				t.Errorf("code blocks = %d, want %d", plan.CodeBlocks, tt.codeBlocks)
+			}
+			if len(plan.CodeLanguages) != 0 || len(tt.languages) != 0 {
+				if !reflect.DeepEqual(plan.CodeLanguages, tt.languages) {
+					t.Errorf("languages = %v, want %v", plan.CodeLanguages, tt.languages)
+				}
+			}
+			if !reflect.DeepEqual(plan.Files, tt.files) {
+				t.Errorf("files = %q, want %q", plan.Files, tt.files)
+			}
+			if plan.Size != len(tt.content) {
+				t.Errorf("size = %d, want %d", plan.Size, len(tt.content))
+			}
+		})
+	}
+}
@@ -1,18 +1,61 @@
 package parser
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
 
 // Plan represents a parsed implementation plan
 type Plan struct {
-	Name      string    `json:"name"`
-	Title     string    `json:"title,omitempty"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	Name             string          `json:"name"`
+	Title            string          `json:"title,omitempty"`
+	Content          string          `json:"content,omitempty"`
+	CreatedAt        time.Time       `json:"created_at,omitempty"`
+	Frontmatter      map[string]any  `json:"frontmatter,omitempty"`
+	Sections         []*Section      `json:"sections"`
+	Checklist        []ChecklistItem `json:"checklist,omitempty"`
+	ChecklistTotal   int             `json:"checklist_total"`
+	ChecklistChecked int             `json:"checklist_checked"`
+	CodeBlocks       int             `json:"code_blocks"`
+	CodeLanguages    map[string]int  `json:"code_languages"`
+	Files            []string        `json:"files,omitempty"` // Referenced file paths
+	Size             int             `json:"size"`            // Content size in bytes
+	SessionIDs       []string        `json:"session_ids"`
+	ProjectName      string          `json:"project_name,omitempty"`
+	ProjectPath      string          `json:"-"`                // Not sent to server
+	Source           string          `json:"source,omitempty"` // Label of the Claude data directory
+	Revision         int             `json:"revision,omitempty"`
+	ContentHash      string          `json:"content_hash,omitempty"`
+	Diff             string          `json:"diff,omitempty"` // Unified diff from the previous revision
+	LinesAdded       int             `json:"lines_added"`
+	LinesRemoved     int             `json:"lines_removed"`
+}
+
+// defaultSource is the label of the default Claude data directory, the
+// same as config.DefaultSourceLabel
+const defaultSource = "default"
+
+// Key identifies the plan among the plans of all sources; see PlanKey
+func (p *Plan) Key() string {
+	return PlanKey(p.Source, p.Name)
+}
+
+// PlanKey returns the key of the named plan of a source. Plans of the
+// default source are keyed by name alone, as before there were sources,
+// so their history and sync state carry over.
+func PlanKey(source, name string) string {
+	if source == "" || source == defaultSource {
+		return name
+	}
+	return source + "/" + name
 }
 
 // ParsePlan parses a markdown plan file
@@ -31,21 +74,148 @@ func ParsePlan(path string) (*Plan, error) {
 	// Extract name from filename (without .md extension)
 	name := filepath.Base(strings.TrimSuffix(path, ".md"))
 
-	// Extract title from first heading
-	title := name
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "# ") {
-			title = strings.TrimPrefix(line, "# ")
-			title = strings.TrimSpace(title)
-			break
+	return ParsePlanContent(name, content, info.ModTime()), nil
+}
+
+// ParsePlanContent parses plan markdown that is not read from a plan file,
+// such as a stored revision
+func ParsePlanContent(name string, content []byte, createdAt time.Time) *Plan {
+	plan := &Plan{
+		Name:          name,
+		Title:         name,
+		Content:       string(content),
+		CreatedAt:     createdAt,
+		Sections:      []*Section{},
+		CodeLanguages: make(map[string]int),
+		Size:          len(content),
+		SessionIDs:    []string{},
+	}
+
+	// Extract frontmatter, sections, checklists, code blocks and file references
+	parseMarkdown(plan, string(content))
+
+	return plan
+}
+
+// LinkPlans scans session transcripts for ExitPlanMode calls carrying a
+// plan's content and for tool calls referencing a plan file, and records
+// the owning sessions on each plan. The project of the first linked
+// session becomes the plan's project.
+func LinkPlans(plans []*Plan, sessionFiles []string) error {
+	if len(plans) == 0 {
+		return nil
+	}
+
+	for _, f := range sessionFiles {
+		refs, err := ScanPlanRefs(f)
+		if err != nil {
+			continue // Skip unreadable transcripts
 		}
+		LinkSession(plans, f, refs)
 	}
 
-	return &Plan{
-		Name:      name,
-		Title:     title,
-		Content:   string(content),
-		CreatedAt: info.ModTime(),
-	}, nil
+	return nil
+}
+
+// PlanRefs are the plan references found in one session transcript. They
+// do not depend on the plans looked for, so they can be kept until the
+// transcript changes.
+type PlanRefs struct {
+	Files    map[string]bool // Names of plan files mentioned
+	Contents map[string]bool // Hashes of plan text passed to ExitPlanMode
+}
+
+// References reports whether the transcript references a plan
+func (r *PlanRefs) References(p *Plan) bool {
+	return r.Files[p.Name] || r.Contents[planTextHash(p.Content)]
+}
+
+// LinkSession records the session of a transcript on the plans it
+// references, as LinkPlans does for each transcript
+func LinkSession(plans []*Plan, sessionFile string, refs *PlanRefs) {
+	sessionID := filepath.Base(strings.TrimSuffix(sessionFile, ".jsonl"))
+	projectPath, projectName := projectFromSessionPath(sessionFile)
+	for _, p := range plans {
+		if !refs.References(p) {
+			continue
+		}
+		p.SessionIDs = append(p.SessionIDs, sessionID)
+		if p.ProjectPath == "" && p.ProjectName == "" {
+			p.ProjectPath = projectPath
+			p.ProjectName = projectName
+		}
+	}
+}
+
+// planFileRef matches a mention of a plan file, capturing the plan name
+var planFileRef = regexp.MustCompile(`plans/([^"\\/\n]+?)\.md`)
+
+// ScanPlanRefs reads the plan references of a single transcript
+func ScanPlanRefs(path string) (*PlanRefs, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	refs := &PlanRefs{Files: make(map[string]bool), Contents: make(map[string]bool)}
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// Write/Edit calls and messages mentioning the plan file
+		for _, m := range planFileRef.FindAllSubmatch(line, -1) {
+			refs.Files[string(m[1])] = true
+		}
+
+		// ExitPlanMode carries the plan text itself
+		if !bytes.Contains(line, []byte(`"ExitPlanMode"`)) {
+			continue
+		}
+		for _, content := range exitPlanModeContents(line) {
+			refs.Contents[planTextHash(content)] = true
+		}
+	}
+
+	return refs, scanner.Err()
+}
+
+// planTextHash identifies plan text regardless of surrounding whitespace
+func planTextHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// exitPlanModeContents extracts the trimmed plan text of every
+// ExitPlanMode tool call in a transcript line
+func exitPlanModeContents(line []byte) []string {
+	var entry RawEntry
+	if err := json.Unmarshal(line, &entry); err != nil || entry.Message == nil {
+		return nil
+	}
+	var msgContent MessageContent
+	if err := json.Unmarshal(entry.Message, &msgContent); err != nil {
+		return nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(msgContent.Content, &blocks); err != nil {
+		return nil
+	}
+
+	var contents []string
+	for _, block := range blocks {
+		if block.Type != "tool_use" || block.Name != "ExitPlanMode" {
+			continue
+		}
+		if input, ok := block.Input.(map[string]any); ok {
+			if plan, ok := input["plan"].(string); ok {
+				contents = append(contents, strings.TrimSpace(plan))
+			}
+		}
+	}
+	return contents
 }
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanKey(t *testing.T) {
+	tests := []struct {
+		source, name string
+		want         string
+	}{
+		{"", "plan", "plan"},
+		{"default", "plan", "plan"},
+		{"work", "plan", "work/plan"},
+	}
+	for _, tt := range tests {
+		if got := (&Plan{Source: tt.source, Name: tt.name}).Key(); got != tt.want {
+			t.Errorf("Key() of %s/%s = %q, want %q", tt.source, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanPlanRefs(t *testing.T) {
+	transcript := `{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Write","input":{"file_path":"/home/u/.claude/plans/first.md"}}]}}
+{"type":"assistant","message":{"content":"compare plans/a.md and plans/b-2.md"}}
+{"type":"assistant","message":{"content":[{"type":"tool_use","name":"ExitPlanMode","input":{"plan":"  # Ship it\n"}}]}}
+`
+	path := filepath.Join(t.TempDir(), "s1.jsonl")
+	if err := os.WriteFile(path, []byte(transcript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := ScanPlanRefs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		plan *Plan
+		want bool
+	}{
+		{&Plan{Name: "first"}, true},
+		{&Plan{Name: "a"}, true},
+		{&Plan{Name: "b-2"}, true},
+		{&Plan{Name: "other", Content: "# Ship it"}, true},
+		{&Plan{Name: "other", Content: "# Ship it later"}, false},
+		{&Plan{Name: "firs"}, false},
+	}
+	for _, tt := range tests {
+		if got := refs.References(tt.plan); got != tt.want {
+			t.Errorf("References(%s, %q) = %v, want %v", tt.plan.Name, tt.plan.Content, got, tt.want)
+		}
+	}
+}
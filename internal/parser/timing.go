@@ -0,0 +1,96 @@
+package parser
+
+import "time"
+
+// DefaultIdleThreshold is the gap between messages above which the
+// session is considered idle rather than actively worked on
+const DefaultIdleThreshold = 10 * time.Minute
+
+// TurnTiming represents the timing of a single user prompt
+type TurnTiming struct {
+	MessageSeq int       `json:"message_sequence,omitempty"`
+	PromptAt   time.Time `json:"prompt_at"`
+	ResponseMs int64     `json:"response_ms,omitempty"` // Prompt to first assistant reply
+	ThinkMs    int64     `json:"think_ms,omitempty"`    // Previous assistant reply to prompt
+}
+
+// timelineEvent is a timestamped message used to derive timing metrics
+type timelineEvent struct {
+	seq    int
+	ts     time.Time
+	role   string
+	prompt bool // User message typed by a human, not a tool result
+}
+
+// computeTiming derives active time, idle gaps, response latency and
+// think time from the message timeline
+func computeTiming(s *Session, events []timelineEvent, idleThreshold time.Duration) {
+	s.Turns = []TurnTiming{}
+
+	var prev time.Time
+	for _, ev := range events {
+		if ev.ts.IsZero() {
+			continue
+		}
+		if !prev.IsZero() {
+			gap := ev.ts.Sub(prev)
+			if gap > idleThreshold {
+				s.IdleGaps++
+				s.IdleSeconds += int(gap.Seconds())
+			} else if gap > 0 {
+				s.ActiveSeconds += int(gap.Seconds())
+			}
+		}
+		prev = ev.ts
+	}
+
+	var lastAssistant time.Time
+	var totalResponse, totalThink int64
+	var responses, thinks int
+	for i, ev := range events {
+		if ev.ts.IsZero() {
+			continue
+		}
+		if ev.role == "assistant" {
+			lastAssistant = ev.ts
+			continue
+		}
+		if !ev.prompt {
+			continue
+		}
+
+		turn := TurnTiming{MessageSeq: ev.seq, PromptAt: ev.ts}
+
+		// Think time only counts when the user came back within the idle threshold
+		if !lastAssistant.IsZero() {
+			if think := ev.ts.Sub(lastAssistant); think >= 0 && think <= idleThreshold {
+				turn.ThinkMs = think.Milliseconds()
+				totalThink += turn.ThinkMs
+				thinks++
+			}
+		}
+
+		for _, next := range events[i+1:] {
+			if next.role == "assistant" && !next.ts.IsZero() {
+				if d := next.ts.Sub(ev.ts); d >= 0 {
+					turn.ResponseMs = d.Milliseconds()
+					totalResponse += turn.ResponseMs
+					responses++
+				}
+				break
+			}
+			if next.prompt {
+				break // Prompt was never answered
+			}
+		}
+
+		s.Turns = append(s.Turns, turn)
+	}
+
+	if responses > 0 {
+		s.AvgResponseMs = totalResponse / int64(responses)
+	}
+	if thinks > 0 {
+		s.AvgThinkMs = totalThink / int64(thinks)
+	}
+}
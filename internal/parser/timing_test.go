@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeTiming(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+
+	tests := []struct {
+		name         string
+		events       []timelineEvent
+		wantActive   int
+		wantIdleGaps int
+		wantIdle     int
+		wantTurns    []TurnTiming
+		wantAvgResp  int64
+		wantAvgThink int64
+	}{
+		{
+			name:      "empty",
+			wantTurns: []TurnTiming{},
+		},
+		{
+			name: "single turn",
+			events: []timelineEvent{
+				{seq: 1, ts: at(0), role: "user", prompt: true},
+				{seq: 2, ts: at(5 * time.Second), role: "assistant"},
+			},
+			wantActive:  5,
+			wantTurns:   []TurnTiming{{MessageSeq: 1, PromptAt: at(0), ResponseMs: 5000}},
+			wantAvgResp: 5000,
+		},
+		{
+			name: "think time and tool results",
+			events: []timelineEvent{
+				{seq: 1, ts: at(0), role: "user", prompt: true},
+				{seq: 2, ts: at(2 * time.Second), role: "assistant"},
+				{seq: 3, ts: at(3 * time.Second), role: "user"}, // Tool result
+				{seq: 4, ts: at(4 * time.Second), role: "assistant"},
+				{seq: 5, ts: at(64 * time.Second), role: "user", prompt: true},
+				{seq: 6, ts: at(68 * time.Second), role: "assistant"},
+			},
+			wantActive: 68,
+			wantTurns: []TurnTiming{
+				{MessageSeq: 1, PromptAt: at(0), ResponseMs: 2000},
+				{MessageSeq: 5, PromptAt: at(64 * time.Second), ResponseMs: 4000, ThinkMs: 60000},
+			},
+			wantAvgResp:  3000,
+			wantAvgThink: 60000,
+		},
+		{
+			name: "idle gap excluded from active time and think time",
+			events: []timelineEvent{
+				{seq: 1, ts: at(0), role: "user", prompt: true},
+				{seq: 2, ts: at(10 * time.Second), role: "assistant"},
+				{seq: 3, ts: at(10*time.Second + time.Hour), role: "user", prompt: true},
+				{seq: 4, ts: at(20*time.Second + time.Hour), role: "assistant"},
+			},
+			wantActive:   20,
+			wantIdleGaps: 1,
+			wantIdle:     3600,
+			wantTurns: []TurnTiming{
+				{MessageSeq: 1, PromptAt: at(0), ResponseMs: 10000},
+				{MessageSeq: 3, PromptAt: at(10*time.Second + time.Hour), ResponseMs: 10000},
+			},
+			wantAvgResp: 10000,
+		},
+		{
+			name: "unanswered prompt and missing timestamps",
+			events: []timelineEvent{
+				{seq: 1, ts: at(0), role: "user", prompt: true},
+				{seq: 2, role: "assistant"},
+				{seq: 3, ts: at(30 * time.Second), role: "user", prompt: true},
+				{seq: 4, ts: at(31 * time.Second), role: "assistant"},
+			},
+			wantActive: 31,
+			wantTurns: []TurnTiming{
+				{MessageSeq: 1, PromptAt: at(0)},
+				{MessageSeq: 3, PromptAt: at(30 * time.Second), ResponseMs: 1000},
+			},
+			wantAvgResp: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{}
+			computeTiming(s, tt.events, DefaultIdleThreshold)
+
+			if s.ActiveSeconds != tt.wantActive || s.IdleGaps != tt.wantIdleGaps || s.IdleSeconds != tt.wantIdle {
+				t.Errorf("active %d, idle gaps %d, idle %d; want %d, %d, %d",
+					s.ActiveSeconds, s.IdleGaps, s.IdleSeconds, tt.wantActive, tt.wantIdleGaps, tt.wantIdle)
+			}
+			if s.AvgResponseMs != tt.wantAvgResp || s.AvgThinkMs != tt.wantAvgThink {
+				t.Errorf("avg response %d, avg think %d; want %d, %d",
+					s.AvgResponseMs, s.AvgThinkMs, tt.wantAvgResp, tt.wantAvgThink)
+			}
+			if len(s.Turns) != len(tt.wantTurns) {
+				t.Fatalf("got %d turns, want %d: %+v", len(s.Turns), len(tt.wantTurns), s.Turns)
+			}
+			for i, turn := range s.Turns {
+				want := tt.wantTurns[i]
+				if turn.MessageSeq != want.MessageSeq || !turn.PromptAt.Equal(want.PromptAt) ||
+					turn.ResponseMs != want.ResponseMs || turn.ThinkMs != want.ThinkMs {
+					t.Errorf("turn %d = %+v, want %+v", i, turn, want)
+				}
+			}
+		})
+	}
+}
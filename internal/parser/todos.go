@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// TodoItem represents a single entry in a TodoWrite list
+type TodoItem struct {
+	Content    string `json:"content"`
+	Status     string `json:"status"` // pending, in_progress, completed
+	ActiveForm string `json:"active_form,omitempty"`
+}
+
+// TodoList represents the final todo list of a session
+type TodoList struct {
+	Items           []TodoItem `json:"items,omitempty"`
+	Total           int        `json:"total"`
+	Completed       int        `json:"completed"`
+	InProgress      int        `json:"in_progress"`
+	Pending         int        `json:"pending"`
+	CompletionRatio float64    `json:"completion_ratio"`
+	Updates         int        `json:"updates"` // Number of TodoWrite calls
+}
+
+// rawTodo matches both the TodoWrite tool input and ~/.claude/todos files
+type rawTodo struct {
+	Content    string `json:"content"`
+	Status     string `json:"status"`
+	ActiveForm string `json:"activeForm"`
+}
+
+// newTodoList builds a TodoList and its counts from raw items
+func newTodoList(raw []rawTodo) *TodoList {
+	list := &TodoList{Items: make([]TodoItem, 0, len(raw))}
+	for _, t := range raw {
+		list.Items = append(list.Items, TodoItem{
+			Content:    t.Content,
+			Status:     t.Status,
+			ActiveForm: t.ActiveForm,
+		})
+		switch t.Status {
+		case "completed":
+			list.Completed++
+		case "in_progress":
+			list.InProgress++
+		default:
+			list.Pending++
+		}
+	}
+	list.Total = len(list.Items)
+	if list.Total > 0 {
+		list.CompletionRatio = float64(list.Completed) / float64(list.Total)
+	}
+	return list
+}
+
+// parseTodoWrite extracts the todo list from a TodoWrite tool input. It
+// fails for input without a todos list, which must not replace the last
+// real list.
+func parseTodoWrite(input any) (*TodoList, bool) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, false
+	}
+	var payload struct {
+		Todos *[]rawTodo `json:"todos"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Todos == nil {
+		return nil, false
+	}
+	return newTodoList(*payload.Todos), true
+}
+
+// ParseTodos reads the most recent todo file for a session from the
+// Claude Code todos directory (files are named <session>-agent-<agent>.json)
+func ParseTodos(dir, sessionID string) (*TodoList, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, sessionID+"*.json"))
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+
+	var latest string
+	var latestMod int64
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		if mod := info.ModTime().UnixNano(); latest == "" || mod > latestMod {
+			latest, latestMod = m, mod
+		}
+	}
+	if latest == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []rawTodo
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return newTodoList(raw), nil
+}
@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTodoWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantOK    bool
+		wantTotal int
+		wantDone  int
+		wantRatio float64
+	}{
+		{"mixed", `{"todos":[{"content":"a","status":"completed"},{"content":"b","status":"in_progress"},{"content":"c","status":"pending"},{"content":"d","status":"completed"}]}`, true, 4, 2, 0.5},
+		{"cleared list", `{"todos":[]}`, true, 0, 0, 0},
+		{"no todos key", `{"other":1}`, false, 0, 0, 0},
+		{"null todos", `{"todos":null}`, false, 0, 0, 0},
+		{"malformed todos", `{"todos":"nope"}`, false, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input any
+			if err := json.Unmarshal([]byte(tt.input), &input); err != nil {
+				t.Fatal(err)
+			}
+			list, ok := parseTodoWrite(input)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if list.Total != tt.wantTotal || list.Completed != tt.wantDone || list.CompletionRatio != tt.wantRatio {
+				t.Errorf("got total %d, completed %d, ratio %v; want %d, %d, %v",
+					list.Total, list.Completed, list.CompletionRatio, tt.wantTotal, tt.wantDone, tt.wantRatio)
+			}
+		})
+	}
+}
+
+func TestSessionTodos(t *testing.T) {
+	todoWrite := func(input string) string {
+		return `{"type":"assistant","message":{"content":[{"type":"tool_use","name":"TodoWrite","input":` + input + `}]}}`
+	}
+	todosDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(todosDir, "s1-agent-s1.json"),
+		[]byte(`[{"content":"from file","status":"completed"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		lines       []string
+		wantItem    string
+		wantUpdates int
+	}{
+		{"last list wins", []string{todoWrite(`{"todos":[{"content":"old","status":"pending"}]}`), todoWrite(`{"todos":[{"content":"new","status":"pending"}]}`)}, "new", 2},
+		{"input without todos ignored", []string{todoWrite(`{"todos":[{"content":"real","status":"pending"}]}`), todoWrite(`{}`)}, "real", 1},
+		{"falls back to todos dir", []string{todoWrite(`{}`)}, "from file", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseJSONLWithOptions(writeSession(t, "s1", tt.lines...), Options{TodosDir: todosDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Todos == nil || len(s.Todos.Items) == 0 {
+				t.Fatalf("todos = %+v, want item %q", s.Todos, tt.wantItem)
+			}
+			if s.Todos.Items[0].Content != tt.wantItem || s.Todos.Updates != tt.wantUpdates {
+				t.Errorf("got item %q, updates %d; want %q, %d", s.Todos.Items[0].Content, s.Todos.Updates, tt.wantItem, tt.wantUpdates)
+			}
+		})
+	}
+}
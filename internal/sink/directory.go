@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Directory writes sessions and plans as JSON files to a local directory:
+// sessions/<id>.json and plans/<name>/<revision>.json
+type Directory struct {
+	name   string
+	dir    string
+	opts   Options
+	logger *slog.Logger
+}
+
+// NewDirectory creates a sink writing below dir
+func NewDirectory(name, dir string, opts Options) *Directory {
+	return &Directory{name: name, dir: dir, opts: opts, logger: opts.Logger}
+}
+
+// Name returns the sink name
+func (d *Directory) Name() string {
+	return d.name
+}
+
+// SendSessions writes one file per session, replacing earlier versions
+func (d *Directory) SendSessions(sessions []*parser.Session, st *State) error {
+	for _, s := range sessions {
+		if err := d.opts.interrupted(); err != nil {
+			return err
+		}
+		path := filepath.Join(d.dir, "sessions", s.ID+".json")
+		if err := writeJSONFile(path, s); err != nil {
+			d.opts.reportError(err)
+			return fmt.Errorf("write session %s: %w", s.ID, err)
+		}
+		st.MarkSession(s.ID)
+	}
+	if len(sessions) > 0 {
+		d.logger.Info("Wrote sessions", "count", len(sessions), "dir", d.dir)
+	}
+	return nil
+}
+
+// SendPlans writes one file per plan revision
+func (d *Directory) SendPlans(plans []*parser.Plan, st *State) error {
+	for _, p := range plans {
+		if err := d.opts.interrupted(); err != nil {
+			return err
+		}
+		path := filepath.Join(d.dir, "plans", filepath.FromSlash(p.Key()), fmt.Sprintf("%d.json", p.Revision))
+		if err := writeJSONFile(path, p); err != nil {
+			d.opts.reportError(err)
+			return fmt.Errorf("write plan %s: %w", p.Name, err)
+		}
+		st.MarkPlan(p)
+	}
+	if len(plans) > 0 {
+		d.logger.Info("Wrote plan revisions", "count", len(plans), "dir", d.dir)
+	}
+	return nil
+}
+
+// writeJSONFile writes v to path through a temporary file so readers
+// never see a partial file
+func writeJSONFile(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,143 @@
+package sink
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/otlp"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// otlpBatchSize caps the sessions per export request
+const otlpBatchSize = 50
+
+// OTLP exports sessions to an OpenTelemetry collector as traces and
+// metrics
+type OTLP struct {
+	name     string
+	exporter *otlp.Exporter
+	resource otlp.Resource
+	policy   *client.RetryPolicy
+	opts     Options
+	logger   *slog.Logger
+}
+
+// NewOTLP creates a sink exporting to the OTLP/HTTP collector at endpoint
+func NewOTLP(name, endpoint string, headers map[string]string, opts Options) *OTLP {
+	return &OTLP{
+		name:     name,
+		exporter: otlp.NewExporter(endpoint, headers),
+		resource: otlp.Resource{Attributes: []otlp.KeyValue{
+			otlp.String("service.name", "claude-insights-agent"),
+		}},
+		policy: opts.newRetryPolicy(),
+		opts:   opts,
+		logger: opts.Logger,
+	}
+}
+
+// Name returns the sink name
+func (o *OTLP) Name() string {
+	return o.name
+}
+
+// SendSessions exports sessions in batches. A batch the collector rejects
+// is exported session by session to find and quarantine the bad ones.
+func (o *OTLP) SendSessions(sessions []*parser.Session, st *State) error {
+	for start := 0; start < len(sessions); start += otlpBatchSize {
+		end := start + otlpBatchSize
+		if end > len(sessions) {
+			end = len(sessions)
+		}
+		batch := sessions[start:end]
+		if err := o.opts.interrupted(); err != nil {
+			return err
+		}
+
+		err := o.export(batch, st)
+		switch {
+		case err == nil:
+			for _, s := range batch {
+				st.MarkSession(s.ID)
+			}
+			o.logger.Info("Exported sessions", "batch_size", len(batch))
+
+		case client.Kind(err) == client.KindAuth:
+			return err
+
+		case client.Kind(err) == client.KindNonRetryable && len(batch) > 1:
+			o.logger.Warn("Batch rejected, exporting sessions individually", "batch_size", len(batch), "error", err)
+			for _, s := range batch {
+				err := o.export([]*parser.Session{s}, st)
+				switch {
+				case err == nil:
+					st.MarkSession(s.ID)
+				case client.Kind(err) == client.KindAuth:
+					return err
+				case client.Kind(err) == client.KindNonRetryable:
+					o.logger.Warn("Session quarantined", "session_id", s.ID, "project", s.ProjectName, "error", err)
+					st.QuarantineSession(s.ID, err)
+				default:
+					o.logger.Warn("Failed to export session, will retry next sync", "session_id", s.ID, "project", s.ProjectName, "error", err)
+				}
+			}
+
+		case client.Kind(err) == client.KindNonRetryable:
+			o.logger.Warn("Session quarantined", "session_id", batch[0].ID, "project", batch[0].ProjectName, "error", err)
+			st.QuarantineSession(batch[0].ID, err)
+
+		default:
+			o.logger.Warn("Failed to export batch, will retry next sync", "batch_size", len(batch), "error", err)
+		}
+	}
+	return nil
+}
+
+// SendPlans marks plans as done: OTLP has no representation for them
+func (o *OTLP) SendPlans(plans []*parser.Plan, st *State) error {
+	for _, p := range plans {
+		st.MarkPlan(p)
+	}
+	return nil
+}
+
+// export sends the metrics and then the traces of sessions. Metrics are
+// delta sums a collector adds up, so they must arrive only once: sessions
+// whose metrics were sent are recorded in st, and exporting them again
+// after their traces failed sends the traces only. Span IDs are stable,
+// so traces may be sent twice without creating new spans.
+func (o *OTLP) export(sessions []*parser.Session, st *State) error {
+	var pending []*parser.Session
+	for _, s := range sessions {
+		if _, ok := st.MetricsExported[s.ID]; !ok {
+			pending = append(pending, s)
+		}
+	}
+	if len(pending) > 0 {
+		metrics := otlp.Metrics(pending, o.resource)
+		err := o.opts.retry(o.policy, func() error {
+			partial, err := o.exporter.ExportMetrics(metrics)
+			if err == nil && partial != nil && (partial.RejectedDataPoints > 0 || partial.ErrorMessage != "") {
+				o.logger.Warn("Collector rejected data points", "rejected", partial.RejectedDataPoints, "message", partial.ErrorMessage)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, s := range pending {
+			st.MetricsExported[s.ID] = now
+		}
+	}
+
+	traces := otlp.Traces(sessions, o.resource)
+	return o.opts.retry(o.policy, func() error {
+		partial, err := o.exporter.ExportTraces(traces)
+		if err == nil && partial != nil && (partial.RejectedSpans > 0 || partial.ErrorMessage != "") {
+			o.logger.Warn("Collector rejected spans", "rejected", partial.RejectedSpans, "message", partial.ErrorMessage)
+		}
+		return err
+	})
+}
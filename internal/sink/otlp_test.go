@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/otlp"
+	"github.com/dkd/claude-insights-agent/internal/otlp/fakecollector"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+func TestOTLPExportsMetricsOnce(t *testing.T) {
+	tests := []struct {
+		name            string
+		failPath        string // Export path failing once, empty for none
+		failStatus      int
+		wantSynced      []bool // After each of two syncs
+		wantQuarantined bool
+	}{
+		{"no failure", "", 0, []bool{true, true}, false},
+		{"traces retryable", otlp.TracesPath, http.StatusServiceUnavailable, []bool{false, true}, false},
+		{"metrics retryable", otlp.MetricsPath, http.StatusServiceUnavailable, []bool{false, true}, false},
+		{"traces rejected", otlp.TracesPath, http.StatusBadRequest, []bool{false, false}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakecollector.New()
+			defer c.Close()
+			if tt.failPath != "" {
+				c.FailNextAt(tt.failPath, tt.failStatus)
+			}
+			o := NewOTLP("otel", c.URL, nil, Options{
+				Sync:   config.SyncConfig{RetryAttempts: 1},
+				Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+
+			st := NewState()
+			session := &parser.Session{
+				ID:     "s1",
+				Models: map[string]*parser.ModelStats{"claude-sonnet-4": {InputTokens: 100}},
+			}
+			for i, want := range tt.wantSynced {
+				if !st.SessionDone(session.ID) {
+					if err := o.SendSessions([]*parser.Session{session}, st); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, synced := st.SyncedSessions[session.ID]; synced != want {
+					t.Errorf("sync %d: synced = %v, want %v", i+1, synced, want)
+				}
+			}
+
+			if _, quarantined := st.Quarantined[session.ID]; quarantined != tt.wantQuarantined {
+				t.Errorf("quarantined = %v, want %v", quarantined, tt.wantQuarantined)
+			}
+			if len(st.MetricsExported) != 0 {
+				t.Errorf("metrics still recorded as pending traces: %v", st.MetricsExported)
+			}
+
+			points := 0
+			for _, m := range c.Metrics() {
+				if m.Name == "claude.tokens" {
+					points += len(m.Sum.DataPoints)
+				}
+			}
+			if points != 4 {
+				t.Errorf("token data points = %d, want 4 (one export)", points)
+			}
+		})
+	}
+}
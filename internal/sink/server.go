@@ -0,0 +1,385 @@
+package sink
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Server uploads to an insights server
+type Server struct {
+	name   string
+	client *client.Client
+	policy *client.RetryPolicy
+	opts   Options
+	logger *slog.Logger
+}
+
+// NewServer creates a sink uploading to the server at url
+func NewServer(name, url, apiKey string, opts Options) *Server {
+	return &Server{
+		name:   name,
+		client: client.New(url, apiKey),
+		policy: opts.newRetryPolicy(),
+		opts:   opts,
+		logger: opts.Logger,
+	}
+}
+
+// Name returns the sink name
+func (s *Server) Name() string {
+	return s.name
+}
+
+// SendSessions uploads sessions in size-capped batches, falling back to
+// chunked uploads for oversized sessions. Only an unreachable server and
+// auth failures are returned; other failures are retried on the next sync
+// or quarantined.
+func (s *Server) SendSessions(sessions []*parser.Session, st *State) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	if err := s.checkHealth(); err != nil {
+		return err
+	}
+
+	sessions, err := s.skipKnownSessions(sessions, st)
+	if err != nil {
+		return err
+	}
+
+	// Sessions too large for a single request are uploaded in chunks
+	var regular []*parser.Session
+	for _, session := range sessions {
+		if s.client.SessionSize(session) <= s.opts.Sync.MaxBatchBytes {
+			regular = append(regular, session)
+			continue
+		}
+		if err := s.opts.interrupted(); err != nil {
+			return err
+		}
+		if err := s.uploadChunked(session, st); client.Kind(err) == client.KindAuth {
+			return err
+		}
+	}
+
+	// Upload in batches capped by compressed size
+	for _, batch := range s.client.SessionBatches(regular, s.opts.Sync.MaxBatchBytes) {
+		if err := s.opts.interrupted(); err != nil {
+			return err
+		}
+		if err := s.uploadSessionBatch(batch, st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendPlans uploads plan revisions in size-capped batches
+func (s *Server) SendPlans(plans []*parser.Plan, st *State) error {
+	if len(plans) == 0 {
+		return nil
+	}
+	if err := s.checkHealth(); err != nil {
+		return err
+	}
+
+	for _, batch := range s.client.PlanBatches(plans, s.opts.Sync.MaxBatchBytes) {
+		if err := s.opts.interrupted(); err != nil {
+			return err
+		}
+		if err := s.uploadPlanBatch(batch, st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkHealth makes sure the server is reachable before uploading
+func (s *Server) checkHealth() error {
+	if err := s.opts.retry(s.policy, s.client.Health); err != nil {
+		return fmt.Errorf("server unavailable: %w", err)
+	}
+	return nil
+}
+
+// skipKnownSessions asks the server which sessions it already stores with
+// the same content, marks those synced and returns the rest. This keeps a
+// lost state file or a reinstall from uploading everything again. If the
+// server cannot answer, all sessions are returned.
+func (s *Server) skipKnownSessions(sessions []*parser.Session, st *State) ([]*parser.Session, error) {
+	hashes := make([]string, 0, len(sessions))
+	byHash := make(map[string]*parser.Session, len(sessions))
+	for _, session := range sessions {
+		hash, err := client.ContentHash(session)
+		if err != nil {
+			return sessions, nil
+		}
+		hashes = append(hashes, hash)
+		byHash[hash] = session
+	}
+
+	var known map[string]bool
+	err := s.opts.retry(s.policy, func() error {
+		var err error
+		known, err = s.client.KnownSessions(hashes)
+		return err
+	})
+	switch {
+	case err == nil:
+	case client.Kind(err) == client.KindAuth:
+		s.logger.Error("Upload rejected", "error", err)
+		return nil, err
+	default:
+		s.logger.Warn("Could not check for sessions already on the server", "error", err)
+		return sessions, nil
+	}
+
+	var remaining []*parser.Session
+	for _, hash := range hashes {
+		session := byHash[hash]
+		if known[hash] {
+			st.MarkSession(session.ID)
+			continue
+		}
+		remaining = append(remaining, session)
+	}
+	if skipped := len(sessions) - len(remaining); skipped > 0 {
+		s.logger.Info("Skipped sessions already on the server", "count", skipped)
+	}
+	return remaining, nil
+}
+
+// uploadSessionBatch uploads a batch and handles each session by its own
+// result: accepted sessions are marked synced, rejected ones quarantined,
+// and retryable or missing ones resent in a smaller batch
+func (s *Server) uploadSessionBatch(batch []*parser.Session, st *State) error {
+	pending := batch
+	for attempt := 1; len(pending) > 0; attempt++ {
+		var responses []*client.SessionResponse
+		err := s.opts.retry(s.policy, func() error {
+			var err error
+			responses, err = s.client.UploadBatch(pending)
+			return err
+		})
+
+		switch {
+		case err == nil:
+		case client.Kind(err) == client.KindAuth:
+			s.logger.Error("Upload rejected", "error", err)
+			return err
+		case client.Kind(err) == client.KindNonRetryable:
+			// Find the offending sessions by uploading one at a time
+			s.logger.Warn("Batch rejected, uploading sessions individually", "batch_size", len(pending), "error", err)
+			for _, session := range pending {
+				if err := s.uploadSession(session, st); client.Kind(err) == client.KindAuth {
+					return err
+				}
+			}
+			return nil
+		default:
+			s.logger.Warn("Failed to upload batch, will retry next sync", "batch_size", len(pending), "error", err)
+			return nil
+		}
+
+		results := client.SessionResults(responses)
+		var retry []*parser.Session
+		uploaded := 0
+		for _, session := range pending {
+			resp := results[session.ID]
+			switch {
+			case resp == nil:
+				s.logger.Warn("Session missing from server response", "session_id", session.ID, "project", session.ProjectName)
+				retry = append(retry, session)
+			case resp.Succeeded():
+				st.MarkSession(session.ID)
+				uploaded++
+				if len(resp.Warnings) > 0 {
+					s.logger.Warn("Server warnings", "session_id", session.ID, "project", session.ProjectName, "warnings", resp.Warnings)
+				}
+			case resp.Retryable():
+				s.opts.reportError(resp.Err())
+				s.logger.Warn("Session failed, retrying", "session_id", session.ID, "project", session.ProjectName, "attempt", attempt, "error", resp.Err())
+				retry = append(retry, session)
+			default:
+				s.opts.reportError(resp.Err())
+				s.quarantineSession(session.ID, resp.Err(), st)
+			}
+		}
+		s.logger.Info("Uploaded sessions", "uploaded", uploaded, "batch_size", len(pending), "attempt", attempt)
+
+		pending = retry
+		if len(pending) == 0 {
+			break
+		}
+		if attempt >= s.policy.Attempts || !s.policy.Wait(s.opts.Stop, attempt) {
+			s.logger.Warn("Sessions left for next sync", "count", len(pending))
+			break
+		}
+	}
+
+	return nil
+}
+
+// uploadSession uploads a single session, quarantining it if the server
+// rejects it
+func (s *Server) uploadSession(session *parser.Session, st *State) error {
+	var resp *client.SessionResponse
+	err := s.opts.retry(s.policy, func() error {
+		var err error
+		resp, err = s.client.Upload(session)
+		return err
+	})
+	if err != nil {
+		if client.Kind(err) == client.KindNonRetryable {
+			s.quarantineSession(session.ID, err, st)
+		} else {
+			s.logger.Warn("Failed to upload session, will retry next sync", "session_id", session.ID, "project", session.ProjectName, "error", err)
+		}
+		return err
+	}
+
+	st.MarkSession(session.ID)
+	if len(resp.Warnings) > 0 {
+		s.logger.Warn("Server warnings", "session_id", session.ID, "project", session.ProjectName, "warnings", resp.Warnings)
+	}
+	return nil
+}
+
+// uploadChunked uploads a large session in chunks, resuming a previously
+// interrupted upload from the last acknowledged chunk
+func (s *Server) uploadChunked(session *parser.Session, st *State) error {
+	progress := st.Upload(session.ID)
+
+	var resp *client.SessionResponse
+	err := s.opts.retry(s.policy, func() error {
+		var err error
+		resp, err = s.client.UploadChunked(session, progress, s.opts.Sync.MaxBatchBytes)
+		return err
+	})
+	if err != nil {
+		if client.Kind(err) == client.KindNonRetryable {
+			s.quarantineSession(session.ID, err, st)
+		} else {
+			s.logger.Warn("Chunked upload stopped, will resume next sync", "session_id", session.ID, "project", session.ProjectName, "offset", progress.Offset, "total", progress.Total, "error", err)
+		}
+		return err
+	}
+
+	st.MarkSession(session.ID)
+	if len(resp.Warnings) > 0 {
+		s.logger.Warn("Server warnings", "session_id", session.ID, "project", session.ProjectName, "warnings", resp.Warnings)
+	}
+	s.logger.Info("Uploaded session in chunks", "session_id", session.ID, "project", session.ProjectName, "records", progress.Total)
+	return nil
+}
+
+// quarantineSession stops retrying a session the server rejected
+func (s *Server) quarantineSession(id string, err error, st *State) {
+	s.logger.Warn("Session quarantined", "session_id", id, "error", err)
+	st.QuarantineSession(id, err)
+}
+
+// uploadPlanBatch uploads a batch of plan revisions and handles each by
+// its own result, like uploadSessionBatch
+func (s *Server) uploadPlanBatch(batch []*parser.Plan, st *State) error {
+	pending := batch
+	for attempt := 1; len(pending) > 0; attempt++ {
+		var responses []*client.PlanResponse
+		err := s.opts.retry(s.policy, func() error {
+			var err error
+			responses, err = s.client.UploadPlanBatch(pending)
+			return err
+		})
+
+		switch {
+		case err == nil:
+		case client.Kind(err) == client.KindAuth:
+			return err
+		case client.Kind(err) == client.KindNonRetryable:
+			// Find the offending plans by uploading one at a time
+			s.logger.Warn("Batch rejected, uploading plans individually", "batch_size", len(pending), "error", err)
+			for _, p := range pending {
+				if err := s.uploadPlan(p, st); client.Kind(err) == client.KindAuth {
+					return err
+				}
+			}
+			return nil
+		default:
+			s.logger.Warn("Failed to upload plan batch, will retry next sync", "batch_size", len(pending), "error", err)
+			return nil
+		}
+
+		results := client.PlanResults(pending, responses)
+		var retry []*parser.Plan
+		uploaded := 0
+		for i, p := range pending {
+			resp := results[i]
+			switch {
+			case resp == nil:
+				s.logger.Warn("Plan missing from server response", "plan", p.Name, "revision", p.Revision)
+				retry = append(retry, p)
+			case resp.Succeeded():
+				st.MarkPlan(p)
+				uploaded++
+				if len(resp.Warnings) > 0 {
+					s.logger.Warn("Server warnings", "plan", p.Name, "revision", p.Revision, "warnings", resp.Warnings)
+				}
+			case resp.Retryable():
+				s.opts.reportError(resp.Err())
+				s.logger.Warn("Plan failed, retrying", "plan", p.Name, "revision", p.Revision, "attempt", attempt, "error", resp.Err())
+				retry = append(retry, p)
+			default:
+				s.opts.reportError(resp.Err())
+				s.quarantinePlan(p, resp.Err(), st)
+			}
+		}
+		s.logger.Info("Uploaded plans", "uploaded", uploaded, "batch_size", len(pending), "attempt", attempt)
+
+		pending = retry
+		if len(pending) == 0 {
+			break
+		}
+		if attempt >= s.policy.Attempts || !s.policy.Wait(s.opts.Stop, attempt) {
+			s.logger.Warn("Plans left for next sync", "count", len(pending))
+			break
+		}
+	}
+
+	return nil
+}
+
+// uploadPlan uploads a single plan revision, quarantining it if the
+// server rejects it
+func (s *Server) uploadPlan(p *parser.Plan, st *State) error {
+	var resp *client.PlanResponse
+	err := s.opts.retry(s.policy, func() error {
+		var err error
+		resp, err = s.client.UploadPlan(p)
+		return err
+	})
+	if err != nil {
+		if client.Kind(err) == client.KindNonRetryable {
+			s.quarantinePlan(p, err, st)
+		} else {
+			s.logger.Warn("Failed to upload plan, will retry next sync", "plan", p.Name, "revision", p.Revision, "error", err)
+		}
+		return err
+	}
+
+	st.MarkPlan(p)
+	if len(resp.Warnings) > 0 {
+		s.logger.Warn("Server warnings", "plan", p.Name, "revision", p.Revision, "warnings", resp.Warnings)
+	}
+	return nil
+}
+
+// quarantinePlan stops retrying a plan revision the server rejected
+func (s *Server) quarantinePlan(p *parser.Plan, err error, st *State) {
+	s.logger.Warn("Plan quarantined", "plan", p.Name, "revision", p.Revision, "error", err)
+	st.QuarantinePlan(p, err)
+}
@@ -0,0 +1,90 @@
+// Package sink delivers filtered sessions and plans to their destinations
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Sink is a destination for sessions and plans. Sinks record the outcome
+// of each item in the given State: delivered items are marked, rejected
+// ones quarantined, and anything left untouched is offered again on the
+// next sync. An error means the sink could not be used this sync.
+type Sink interface {
+	Name() string
+	SendSessions(sessions []*parser.Session, st *State) error
+	SendPlans(plans []*parser.Plan, st *State) error
+}
+
+// Options are shared by all sinks
+type Options struct {
+	Sync   config.SyncConfig
+	Logger *slog.Logger
+	Stop   <-chan struct{} // Abandons retries when closed
+
+	// OnError, if set, is called for every failed delivery attempt and
+	// every item the destination rejects
+	OnError func(err error)
+
+	// Interrupted, if set, is checked between batches. Once it reports
+	// true the sink stops with ErrInterrupted, leaving the remaining items
+	// to be filtered again under the new config.
+	Interrupted func() bool
+}
+
+// ErrInterrupted is returned by sinks that stopped between batches
+// because a new config is waiting
+var ErrInterrupted = errors.New("interrupted by a config change")
+
+// interrupted returns ErrInterrupted once the Interrupted hook reports true
+func (o Options) interrupted() error {
+	if o.Interrupted != nil && o.Interrupted() {
+		return ErrInterrupted
+	}
+	return nil
+}
+
+// reportError passes err to the OnError hook
+func (o Options) reportError(err error) {
+	if o.OnError != nil && err != nil {
+		o.OnError(err)
+	}
+}
+
+// newRetryPolicy creates the retry policy of a sink, logging retries
+func (o Options) newRetryPolicy() *client.RetryPolicy {
+	retry := client.NewRetryPolicy(o.Sync.RetryAttempts)
+	retry.OnRetry = func(attempt int, err error, delay time.Duration) {
+		o.Logger.Warn("Request failed, retrying", "attempt", attempt, "kind", client.Kind(err).String(), "error", err, "delay", delay.Round(time.Second))
+	}
+	return retry
+}
+
+// retry calls fn under the retry policy, reporting every failed attempt
+func (o Options) retry(policy *client.RetryPolicy, fn func() error) error {
+	return policy.Do(o.Stop, func() error {
+		err := fn()
+		o.reportError(err)
+		return err
+	})
+}
+
+// New creates the sink described by cfg
+func New(cfg config.SinkConfig, opts Options) (Sink, error) {
+	switch cfg.Type {
+	case config.SinkServer:
+		return NewServer(cfg.Name, cfg.URL, cfg.APIKey, opts), nil
+	case config.SinkDirectory:
+		return NewDirectory(cfg.Name, cfg.Path, opts), nil
+	case config.SinkOTLP:
+		return NewOTLP(cfg.Name, cfg.URL, cfg.Headers, opts), nil
+	}
+	return nil, fmt.Errorf("sink %s: unknown type %q", cfg.Name, cfg.Type)
+}
@@ -0,0 +1,214 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/client/fakeserver"
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/otlp/fakecollector"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// interruptAfter returns an Interrupted hook reporting a config change
+// once it has been checked n times
+func interruptAfter(n int) func() bool {
+	calls := 0
+	return func() bool {
+		calls++
+		return calls > n
+	}
+}
+
+// sessionsOfSize returns n sessions of equal size
+func sessionsOfSize(n int) []*parser.Session {
+	var sessions []*parser.Session
+	for i := 0; i < n; i++ {
+		sessions = append(sessions, &parser.Session{
+			ID:       fmt.Sprintf("s%d", i),
+			Model:    "claude-sonnet-4",
+			Messages: []parser.Message{{Seq: 1, Role: "user", Content: "hello"}},
+			Models:   map[string]*parser.ModelStats{"claude-sonnet-4": {InputTokens: 10}},
+		})
+	}
+	return sessions
+}
+
+func TestSendSessionsInterrupted(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sessionSize := client.New("http://unused", "").SessionSize(sessionsOfSize(1)[0])
+
+	tests := []struct {
+		name     string
+		sessions int
+		checks   int // Interrupted checks passed before the config changes
+		wantSent int
+		newSink  func(t *testing.T, opts Options) (Sink, func() int) // Returns the sink and a count of sessions received
+	}{
+		{"directory", 3, 1, 1, newTestDirectory},
+		{"directory not interrupted", 3, 3, 3, newTestDirectory},
+		{"server batches", 3, 2, 2, newTestServer(sessionSize * 3 / 2)},
+		{"server chunked", 3, 1, 1, newTestServer(1)},
+		{"server not interrupted", 3, 3, 3, newTestServer(sessionSize * 3 / 2)},
+		{"otlp", otlpBatchSize + 10, 1, otlpBatchSize, newTestOTLP},
+		{"otlp not interrupted", otlpBatchSize + 10, 2, otlpBatchSize + 10, newTestOTLP},
+		{"interrupted before sending", 3, 0, 0, newTestDirectory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, sent := tt.newSink(t, Options{
+				Sync:        config.SyncConfig{RetryAttempts: 1, MaxBatchBytes: 4 * 1024 * 1024},
+				Logger:      logger,
+				Interrupted: interruptAfter(tt.checks),
+			})
+			st := NewState()
+			sessions := sessionsOfSize(tt.sessions)
+
+			err := s.SendSessions(sessions, st)
+			if interrupted := tt.wantSent < tt.sessions; interrupted != errors.Is(err, ErrInterrupted) {
+				t.Fatalf("err = %v, want interrupted %v", err, interrupted)
+			}
+			if got := sent(); got != tt.wantSent {
+				t.Errorf("sent = %d, want %d", got, tt.wantSent)
+			}
+			for i, session := range sessions {
+				if done, want := st.SessionDone(session.ID), i < tt.wantSent; done != want {
+					t.Errorf("%s done = %v, want %v", session.ID, done, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSendPlansInterrupted(t *testing.T) {
+	var plans []*parser.Plan
+	for i := 0; i < 3; i++ {
+		plans = append(plans, &parser.Plan{Name: fmt.Sprintf("plan-%d", i), Revision: 1})
+	}
+	s, _ := newTestDirectory(t, Options{
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Interrupted: interruptAfter(2),
+	})
+	st := NewState()
+
+	if err := s.SendPlans(plans, st); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("err = %v, want %v", err, ErrInterrupted)
+	}
+	for i, p := range plans {
+		if done, want := st.PlanRevisions[p.Key()] == p.Revision, i < 2; done != want {
+			t.Errorf("%s done = %v, want %v", p.Name, done, want)
+		}
+	}
+}
+
+func TestPlanRevisionGap(t *testing.T) {
+	srv := fakeserver.New("key")
+	defer srv.Close()
+	s := NewServer("server", srv.URL, "key", Options{
+		Sync:   config.SyncConfig{RetryAttempts: 1, MaxBatchBytes: 4 * 1024 * 1024},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	st := NewState()
+
+	var plans []*parser.Plan
+	for rev := 1; rev <= 3; rev++ {
+		plans = append(plans, &parser.Plan{Name: "p", Revision: rev})
+	}
+	srv.FailItem("p@2", client.StatusRetry, "try again")
+
+	if err := s.SendPlans(plans, st); err != nil {
+		t.Fatal(err)
+	}
+	st.SettlePlans(plans)
+	if got := st.PlanRevisions["p"]; got != 1 {
+		t.Errorf("synced up to revision %d, want 1 while revision 2 is pending", got)
+	}
+	if !st.PlanDone(plans[2]) || st.PlanDone(plans[1]) {
+		t.Errorf("done: revision 2 %v, revision 3 %v, want false, true", st.PlanDone(plans[1]), st.PlanDone(plans[2]))
+	}
+	if _, ok := st.SyncedPlans["p"]; ok {
+		t.Error("plan recorded as synced with revision 2 pending")
+	}
+
+	// The next sync sends only the failed revision
+	if err := s.SendPlans(plans[1:2], st); err != nil {
+		t.Fatal(err)
+	}
+	st.SettlePlans(plans[1:2])
+	if got := st.PlanRevisions["p"]; got != 3 {
+		t.Errorf("synced up to revision %d, want 3", got)
+	}
+	if len(st.PlanRevisionsAhead) != 0 {
+		t.Errorf("revisions ahead = %v, want none", st.PlanRevisionsAhead)
+	}
+	if _, ok := st.SyncedPlans["p"]; !ok {
+		t.Error("plan not recorded as synced")
+	}
+	if got := len(srv.Plans()); got != 3 {
+		t.Errorf("server stored %d revisions, want 3", got)
+	}
+}
+
+func TestPlanResultsBySource(t *testing.T) {
+	srv := fakeserver.New("key")
+	defer srv.Close()
+	s := NewServer("server", srv.URL, "key", Options{
+		Sync:   config.SyncConfig{RetryAttempts: 1, MaxBatchBytes: 4 * 1024 * 1024},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	st := NewState()
+
+	// Same name and revision in two sources; the server rejects the first
+	work := &parser.Plan{Name: "a", Source: "work", Revision: 1}
+	home := &parser.Plan{Name: "a", Source: "home", Revision: 1}
+	srv.FailItem("a", client.StatusRejected, "bad plan")
+
+	if err := s.SendPlans([]*parser.Plan{work, home}, st); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.QuarantinedPlans["work/a@1"]; !ok {
+		t.Errorf("rejected plan not quarantined: %v", st.QuarantinedPlans)
+	}
+	if _, ok := st.QuarantinedPlans["home/a@1"]; ok {
+		t.Error("accepted plan quarantined")
+	}
+	if got := srv.Plans(); len(got) != 1 || got[0].Source != "home" {
+		t.Errorf("server stored %+v, want the home plan", got)
+	}
+}
+
+func newTestDirectory(t *testing.T, opts Options) (Sink, func() int) {
+	d := NewDirectory("dir", t.TempDir(), opts)
+	return d, func() int {
+		entries, _ := filepath.Glob(filepath.Join(d.dir, "sessions", "*.json"))
+		return len(entries)
+	}
+}
+
+// newTestServer returns a constructor for a server sink with the given
+// batch size limit
+func newTestServer(maxBatchBytes int) func(t *testing.T, opts Options) (Sink, func() int) {
+	return func(t *testing.T, opts Options) (Sink, func() int) {
+		srv := fakeserver.New("key")
+		t.Cleanup(srv.Close)
+		opts.Sync.MaxBatchBytes = maxBatchBytes
+		return NewServer("server", srv.URL, "key", opts), srv.SessionCount
+	}
+}
+
+func newTestOTLP(t *testing.T, opts Options) (Sink, func() int) {
+	c := fakecollector.New()
+	t.Cleanup(c.Close)
+	return NewOTLP("otel", c.URL, nil, opts), func() int {
+		traces := make(map[string]bool)
+		for _, s := range c.Spans() {
+			traces[s.TraceID] = true
+		}
+		return len(traces)
+	}
+}
@@ -0,0 +1,175 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// State tracks what a single sink has received, so a failing sink does
+// not hold back the others
+type State struct {
+	SyncedSessions     map[string]time.Time              `json:"synced_sessions"`
+	SyncedPlans        map[string]time.Time              `json:"synced_plans"`
+	PlanRevisions      map[string]int                    `json:"plan_revisions,omitempty"`       // Last revision per plan up to which all are synced
+	PlanRevisionsAhead map[string][]int                  `json:"plan_revisions_ahead,omitempty"` // Revisions synced past one still pending
+	Uploads            map[string]*client.UploadProgress `json:"uploads,omitempty"`              // Unfinished chunked uploads
+	Quarantined        map[string]Quarantine             `json:"quarantined,omitempty"`
+	QuarantinedPlans   map[string]Quarantine             `json:"quarantined_plans,omitempty"` // Keyed by name@revision
+	MetricsExported    map[string]time.Time              `json:"metrics_exported,omitempty"`  // Sessions whose OTLP metrics were sent but not yet their traces
+}
+
+// Quarantine records an item the destination rejected and that is not retried
+type Quarantine struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error"`
+}
+
+// NewState creates an empty sink state
+func NewState() *State {
+	st := &State{}
+	st.Init()
+	return st
+}
+
+// Init creates the maps a decoded state may lack
+func (st *State) Init() {
+	if st.SyncedSessions == nil {
+		st.SyncedSessions = make(map[string]time.Time)
+	}
+	if st.SyncedPlans == nil {
+		st.SyncedPlans = make(map[string]time.Time)
+	}
+	if st.PlanRevisions == nil {
+		st.PlanRevisions = make(map[string]int)
+	}
+	if st.PlanRevisionsAhead == nil {
+		st.PlanRevisionsAhead = make(map[string][]int)
+	}
+	if st.Uploads == nil {
+		st.Uploads = make(map[string]*client.UploadProgress)
+	}
+	if st.Quarantined == nil {
+		st.Quarantined = make(map[string]Quarantine)
+	}
+	if st.QuarantinedPlans == nil {
+		st.QuarantinedPlans = make(map[string]Quarantine)
+	}
+	if st.MetricsExported == nil {
+		st.MetricsExported = make(map[string]time.Time)
+	}
+}
+
+// SessionDone reports whether a session was synced or quarantined
+func (st *State) SessionDone(id string) bool {
+	if _, ok := st.SyncedSessions[id]; ok {
+		return true
+	}
+	_, ok := st.Quarantined[id]
+	return ok
+}
+
+// MarkSession records a session as delivered
+func (st *State) MarkSession(id string) {
+	st.SyncedSessions[id] = time.Now()
+	delete(st.Uploads, id)
+	delete(st.MetricsExported, id)
+}
+
+// QuarantineSession stops retrying a session the destination rejected
+func (st *State) QuarantineSession(id string, err error) {
+	st.Quarantined[id] = newQuarantine(err)
+	delete(st.Uploads, id)
+	delete(st.MetricsExported, id)
+}
+
+// Upload returns the chunked upload progress of a session, creating it
+// if none is recorded
+func (st *State) Upload(id string) *client.UploadProgress {
+	progress := st.Uploads[id]
+	if progress == nil {
+		progress = &client.UploadProgress{}
+		st.Uploads[id] = progress
+	}
+	return progress
+}
+
+// PlanChanged reports whether a plan file modified at modTime may hold
+// content the sink has not seen
+func (st *State) PlanChanged(name string, modTime time.Time) bool {
+	lastSynced, synced := st.SyncedPlans[name]
+	return !synced || modTime.After(lastSynced)
+}
+
+// TouchPlan records that a plan was checked and has nothing new
+func (st *State) TouchPlan(name string) {
+	st.SyncedPlans[name] = time.Now()
+}
+
+// PlanDone reports whether a plan revision was synced or quarantined
+func (st *State) PlanDone(p *parser.Plan) bool {
+	key := p.Key()
+	return p.Revision <= st.PlanRevisions[key] || slices.Contains(st.PlanRevisionsAhead[key], p.Revision)
+}
+
+// MarkPlan records a plan revision as delivered. PlanRevisions only
+// moves up across revisions that are all delivered, so a revision that
+// failed is sent again even if a later one got through.
+func (st *State) MarkPlan(p *parser.Plan) {
+	if st.PlanDone(p) {
+		return
+	}
+	key := p.Key()
+	ahead := append(st.PlanRevisionsAhead[key], p.Revision)
+
+	last := st.PlanRevisions[key]
+	for slices.Contains(ahead, last+1) {
+		last++
+	}
+	st.PlanRevisions[key] = last
+
+	ahead = slices.DeleteFunc(ahead, func(rev int) bool { return rev <= last })
+	if len(ahead) == 0 {
+		delete(st.PlanRevisionsAhead, key)
+	} else {
+		st.PlanRevisionsAhead[key] = ahead
+	}
+}
+
+// SettlePlans records the plans whose given revisions were all delivered
+// as synced, so they are not checked again until their file changes.
+// Plans with a revision still pending are left untouched.
+func (st *State) SettlePlans(plans []*parser.Plan) {
+	pending := make(map[string]bool)
+	for _, p := range plans {
+		pending[p.Key()] = pending[p.Key()] || !st.PlanDone(p)
+	}
+	for key, waiting := range pending {
+		if !waiting {
+			st.TouchPlan(key)
+		}
+	}
+}
+
+// QuarantinePlan stops retrying a plan revision the destination rejected
+// and moves past it so later revisions can sync
+func (st *State) QuarantinePlan(p *parser.Plan, err error) {
+	st.QuarantinedPlans[fmt.Sprintf("%s@%d", p.Key(), p.Revision)] = newQuarantine(err)
+	st.MarkPlan(p)
+}
+
+// newQuarantine builds a quarantine entry from an upload error
+func newQuarantine(err error) Quarantine {
+	q := Quarantine{At: time.Now(), Error: err.Error()}
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		q.StatusCode = apiErr.StatusCode
+		q.Error = apiErr.Message
+	}
+	return q
+}
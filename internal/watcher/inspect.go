@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// Session statuses reported by SessionStatus
+const (
+	StatusSynced   = "synced"   // Delivered to the sink
+	StatusExcluded = "excluded" // Withheld by the privacy filter
+	StatusPending  = "pending"  // Waiting for the next sync
+	StatusFailed   = "failed"   // Rejected by the sink and quarantined
+)
+
+// SinkStatus is the sync status of a session for one sink
+type SinkStatus struct {
+	Sink   string     `json:"sink"`
+	Status string     `json:"status"`
+	At     *time.Time `json:"at,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// ReloadState re-reads the sync state, which a running daemon may have
+// changed since it was last loaded
+func (w *Watcher) ReloadState() error {
+	return w.loadState()
+}
+
+// SessionFiles returns the paths of all session logs
+func (w *Watcher) SessionFiles() ([]string, error) {
+	files, err := w.sessionFiles()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// ParseSession parses a session log returned by SessionFiles with the
+// configured parser options, tagging it with its source
+func (w *Watcher) ParseSession(path string) (*parser.Session, error) {
+	f := sessionFile{path: path}
+	for _, src := range w.sources {
+		if rel, err := filepath.Rel(src.Path, path); err == nil && !strings.HasPrefix(rel, "..") {
+			f.source = src
+			break
+		}
+	}
+	return w.parseSession(f)
+}
+
+// SessionStatus returns the status of a session for every sink
+func (w *Watcher) SessionStatus(s *parser.Session) []SinkStatus {
+	statuses := make([]SinkStatus, 0, len(w.targets))
+	for _, t := range w.targets {
+		st := w.sinkState(t.sink.Name())
+		status := SinkStatus{Sink: t.sink.Name(), Status: StatusPending}
+
+		if q, ok := st.Quarantined[s.ID]; ok {
+			at := q.At
+			status.Status, status.At, status.Error = StatusFailed, &at, q.Error
+		} else if at, ok := st.SyncedSessions[s.ID]; ok {
+			// Excluded sessions are recorded as synced so they are not
+			// parsed again; the filter tells them apart
+			status.Status, status.At = StatusSynced, &at
+			if t.filter(s.Source).Apply(s) == nil {
+				status.Status = StatusExcluded
+			}
+		} else if t.filter(s.Source).Apply(s) == nil {
+			status.Status = StatusExcluded
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Shared returns what the named sink receives for a session: the output
+// of its privacy filter, or nil if the session is excluded. ok is false
+// if there is no such sink.
+func (w *Watcher) Shared(s *parser.Session, sinkName string) (shared *parser.Session, ok bool) {
+	for _, t := range w.targets {
+		if t.sink.Name() == sinkName {
+			return t.filter(s.Source).Apply(s), true
+		}
+	}
+	return nil, false
+}
+
+// SinkNames returns the names of the configured sinks
+func (w *Watcher) SinkNames() []string {
+	names := make([]string, 0, len(w.targets))
+	for _, t := range w.targets {
+		names = append(names, t.sink.Name())
+	}
+	return names
+}
@@ -0,0 +1,187 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/client"
+	"github.com/dkd/claude-insights-agent/internal/metrics"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+	"github.com/dkd/claude-insights-agent/internal/sink"
+)
+
+// watcherMetrics holds the metrics the watcher maintains
+type watcherMetrics struct {
+	registry *metrics.Registry
+
+	syncDuration *metrics.Histogram
+	syncs        *metrics.Counter
+	lastSync     *metrics.Gauge
+	lastSuccess  *metrics.Gauge
+	outbox       *metrics.Gauge
+	uploadErrors *metrics.Counter
+	sinkUp       *metrics.Gauge
+	filesScanned *metrics.Counter
+	parseErrors  *metrics.Counter
+
+	// Usage counters, nil unless enabled in the config
+	tokens    *metrics.Counter
+	toolCalls *metrics.Counter
+	counted   map[string]*sessionUsage // By session file
+}
+
+// sessionUsage is what a session file has added to the usage counters
+type sessionUsage struct {
+	modTime time.Time
+	tokens  map[[3]string]int // By model, project and token type
+	tools   map[[2]string]int // By tool and result
+}
+
+func newWatcherMetrics(usage bool) *watcherMetrics {
+	r := metrics.New()
+	m := &watcherMetrics{
+		registry: r,
+		syncDuration: r.Histogram("claude_insights_sync_duration_seconds",
+			"Duration of sync runs", metrics.DefaultBuckets),
+		syncs: r.Counter("claude_insights_syncs_total",
+			"Sync runs by result", "result"),
+		lastSync: r.Gauge("claude_insights_last_sync_timestamp_seconds",
+			"Unix time of the last sync run"),
+		lastSuccess: r.Gauge("claude_insights_last_successful_sync_timestamp_seconds",
+			"Unix time of the last sync run in which every sink succeeded"),
+		outbox: r.Gauge("claude_insights_outbox_depth",
+			"Sessions and plan revisions waiting to be sent", "sink", "kind"),
+		uploadErrors: r.Counter("claude_insights_upload_errors_total",
+			"Failed delivery attempts and rejected items by error type", "sink", "type"),
+		sinkUp: r.Gauge("claude_insights_sink_up",
+			"Whether the last sync to a sink succeeded", "sink"),
+		filesScanned: r.Counter("claude_insights_files_scanned_total",
+			"Session and plan files parsed", "kind"),
+		parseErrors: r.Counter("claude_insights_parse_errors_total",
+			"Session and plan files that failed to parse", "kind"),
+	}
+	if usage {
+		m.tokens = r.Counter("claude_insights_tokens_total",
+			"Tokens used in local sessions", "model", "project", "type")
+		m.toolCalls = r.Counter("claude_insights_tool_calls_total",
+			"Tool calls in local sessions", "tool", "result")
+		m.counted = make(map[string]*sessionUsage)
+	}
+	return m
+}
+
+// errorHook returns the sink OnError hook counting errors for a sink
+func (m *watcherMetrics) errorHook(sinkName string) func(error) {
+	return func(err error) {
+		m.uploadErrors.Inc(sinkName, client.Kind(err).String())
+	}
+}
+
+// observeSync records the outcome of a sync run
+func (m *watcherMetrics) observeSync(start time.Time, err error) {
+	now := time.Now()
+	m.syncDuration.Observe(now.Sub(start).Seconds())
+	m.lastSync.Set(float64(now.Unix()))
+	if err != nil {
+		m.syncs.Inc("error")
+		return
+	}
+	m.syncs.Inc("success")
+	m.lastSuccess.Set(float64(now.Unix()))
+}
+
+// observeSink records the outcome and remaining outbox of a sink
+func (m *watcherMetrics) observeSink(name string, st *sink.State, sessions []*parser.Session, plans []*parser.Plan, err error) {
+	up := 1.0
+	if err != nil {
+		up = 0
+	}
+	m.sinkUp.Set(up, name)
+
+	pendingSessions := 0
+	for _, s := range sessions {
+		if !st.SessionDone(s.ID) {
+			pendingSessions++
+		}
+	}
+	pendingPlans := 0
+	for _, p := range plans {
+		if !st.PlanDone(p) {
+			pendingPlans++
+		}
+	}
+	m.outbox.Set(float64(pendingSessions), name, "session")
+	m.outbox.Set(float64(pendingPlans), name, "plan")
+}
+
+// countsUsage reports whether the usage counters are enabled
+func (m *watcherMetrics) countsUsage() bool {
+	return m.counted != nil
+}
+
+// usageChanged reports whether a session file modified at modTime may
+// hold usage not yet counted
+func (m *watcherMetrics) usageChanged(path string, modTime time.Time) bool {
+	u := m.counted[path]
+	return u == nil || !modTime.Equal(u.modTime)
+}
+
+// ignoreUsage records a session file whose usage is not counted, so it
+// is not parsed again until it changes
+func (m *watcherMetrics) ignoreUsage(path string, modTime time.Time) {
+	if m.counted == nil {
+		return
+	}
+	if u := m.counted[path]; u != nil {
+		u.modTime = modTime
+		return
+	}
+	m.counted[path] = &sessionUsage{modTime: modTime, tokens: make(map[[3]string]int), tools: make(map[[2]string]int)}
+}
+
+// countUsage adds the token usage and tool calls of a session file's
+// session to the usage counters, as far as they exceed what the file
+// added before. A session that keeps growing is counted by its growth.
+func (m *watcherMetrics) countUsage(path string, modTime time.Time, s *parser.Session) {
+	if m.counted == nil {
+		return
+	}
+	u := m.counted[path]
+	if u == nil {
+		u = &sessionUsage{tokens: make(map[[3]string]int), tools: make(map[[2]string]int)}
+		m.counted[path] = u
+	}
+	u.modTime = modTime
+
+	for model, mu := range s.Models {
+		for _, t := range []struct {
+			kind string
+			n    int
+		}{
+			{"input", mu.InputTokens},
+			{"output", mu.OutputTokens},
+			{"cache_read", mu.CacheReadTokens},
+			{"cache_creation", mu.CacheCreationTokens},
+		} {
+			labels := [3]string{model, s.ProjectName, t.kind}
+			if n, ok := u.tokens[labels]; !ok || t.n > n {
+				m.tokens.Add(float64(t.n-n), labels[:]...)
+				u.tokens[labels] = t.n
+			}
+		}
+	}
+	for tool, t := range s.Tools {
+		for _, r := range []struct {
+			result string
+			n      int
+		}{
+			{"success", t.Count - t.Errors},
+			{"error", t.Errors},
+		} {
+			labels := [2]string{tool, r.result}
+			if n, ok := u.tools[labels]; !ok || r.n > n {
+				m.toolCalls.Add(float64(r.n-n), labels[:]...)
+				u.tools[labels] = r.n
+			}
+		}
+	}
+}
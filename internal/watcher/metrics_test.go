@@ -0,0 +1,142 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+)
+
+// usageSession returns a session with the given input tokens and Bash
+// calls and errors
+func usageSession(input, calls, errors int) *parser.Session {
+	return &parser.Session{
+		ID:          "s1",
+		ProjectName: "app",
+		Models:      map[string]*parser.ModelStats{"claude-sonnet-4": {InputTokens: input}},
+		Tools:       map[string]*parser.ToolStats{"Bash": {Count: calls, Errors: errors}},
+	}
+}
+
+// metricLine returns the sample line of a series in the text exposition
+func metricLine(t *testing.T, m *watcherMetrics, prefix string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := m.registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestCountUsage(t *testing.T) {
+	const (
+		inputSeries = `claude_insights_tokens_total{model="claude-sonnet-4",project="app",type="input"}`
+		errorSeries = `claude_insights_tool_calls_total{tool="Bash",result="error"}`
+		okSeries    = `claude_insights_tool_calls_total{tool="Bash",result="success"}`
+	)
+	t0 := time.Date(2026, 4, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		counts    []*parser.Session // Successive parses of one session file
+		wantInput string
+		wantOK    string
+		wantError string
+	}{
+		{"once", []*parser.Session{usageSession(100, 3, 1)}, "100", "2", "1"},
+		{"growing session", []*parser.Session{usageSession(100, 3, 1), usageSession(250, 5, 1)}, "250", "4", "1"},
+		{"unchanged", []*parser.Session{usageSession(100, 3, 1), usageSession(100, 3, 1)}, "100", "2", "1"},
+		{"shrunk then grown", []*parser.Session{usageSession(100, 3, 1), usageSession(40, 1, 0), usageSession(120, 3, 1)}, "120", "2", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWatcherMetrics(true)
+			for i, s := range tt.counts {
+				m.countUsage("/p/s1.jsonl", t0.Add(time.Duration(i)*time.Minute), s)
+			}
+			for series, want := range map[string]string{inputSeries: tt.wantInput, okSeries: tt.wantOK, errorSeries: tt.wantError} {
+				if got := metricLine(t, m, series); got != series+" "+want {
+					t.Errorf("%s = %q, want %s", series, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUsageChanged(t *testing.T) {
+	t0 := time.Date(2026, 4, 1, 10, 0, 0, 0, time.UTC)
+	m := newWatcherMetrics(true)
+	m.countUsage("/p/a.jsonl", t0, usageSession(1, 0, 0))
+
+	tests := []struct {
+		path    string
+		modTime time.Time
+		want    bool
+	}{
+		{"/p/a.jsonl", t0, false},
+		{"/p/a.jsonl", t0.Add(time.Second), true},
+		{"/p/b.jsonl", t0, true},
+	}
+	for _, tt := range tests {
+		if got := m.usageChanged(tt.path, tt.modTime); got != tt.want {
+			t.Errorf("usageChanged(%s, %v) = %v, want %v", tt.path, tt.modTime, got, tt.want)
+		}
+	}
+
+	if off := newWatcherMetrics(false); off.countsUsage() {
+		t.Error("usage counted while disabled")
+	}
+}
+
+func TestCountUsageSkipsUnshared(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	work, private := t.TempDir(), t.TempDir()
+	for _, s := range []struct{ source, project string }{{work, "app"}, {work, "secret"}, {private, "diary"}} {
+		dir := filepath.Join(s.source, "projects", "-home-u-"+s.project)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		line := `{"type":"assistant","timestamp":"2026-01-01T10:00:00Z","cwd":"/home/u/` + s.project + `","message":{"model":"claude-sonnet-4","content":"ok","usage":{"input_tokens":10,"output_tokens":5}}}` + "\n"
+		if err := os.WriteFile(filepath.Join(dir, s.project+".jsonl"), []byte(line), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig(work, t.TempDir(), "**/secret")
+	cfg.Sources = []config.SourceConfig{{Label: "work", Path: work}, {Label: "private", Path: private, ShareLevel: "none"}}
+	cfg.Metrics.Usage = true
+	w := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := w.SyncOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		project string
+		want    bool
+	}{
+		{"app", true},
+		{"secret", false}, // Excluded project
+		{"diary", false},  // Source at share level none
+	}
+	for _, tt := range tests {
+		series := `claude_insights_tokens_total{model="claude-sonnet-4",project="` + tt.project + `",type="input"}`
+		if got := metricLine(t, w.metrics, series) != ""; got != tt.want {
+			t.Errorf("%s counted = %v, want %v", tt.project, got, tt.want)
+		}
+	}
+	if got := len(w.metrics.counted); got != 3 {
+		t.Errorf("%d session files recorded, want all 3 so unshared ones are not parsed again", got)
+	}
+}
@@ -2,81 +2,239 @@ package watcher
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/dkd/claude-insights-agent/internal/client"
 	"github.com/dkd/claude-insights-agent/internal/config"
 	"github.com/dkd/claude-insights-agent/internal/filter"
+	"github.com/dkd/claude-insights-agent/internal/history"
+	"github.com/dkd/claude-insights-agent/internal/metrics"
 	"github.com/dkd/claude-insights-agent/internal/parser"
+	"github.com/dkd/claude-insights-agent/internal/sink"
 )
 
-// State tracks which sessions and plans have been synced
+// State tracks which sessions and plans each sink has received
 type State struct {
-	SyncedSessions map[string]time.Time `json:"synced_sessions"`
-	SyncedPlans    map[string]time.Time `json:"synced_plans"`
-	LastSync       time.Time            `json:"last_sync"`
+	Sinks    map[string]*sink.State `json:"sinks"`
+	LastSync time.Time              `json:"last_sync"`
 }
 
-// Watcher monitors Claude logs and syncs to server
+// Watcher monitors Claude logs and syncs to the configured sinks
 type Watcher struct {
 	cfg       *config.Config
-	client    *client.Client
-	filter    *filter.Filter
+	targets   []*target
+	history   *history.Store
 	state     *State
 	statePath string
-	logsPath  string
-	logger    *log.Logger
+	sources   []config.SourceConfig
+	logger    *slog.Logger
+	metrics   *watcherMetrics
 	stopCh    chan struct{}
+
+	// Plan references of each transcript are kept until it changes;
+	// planRefsGen counts the changes so held plans are only retried
+	// when a transcript may link them
+	planRefs    map[string]*transcriptRefs // By transcript path
+	planRefsGen int
+	heldPlans   map[string]map[string]heldPlan // By sink name and plan key
+
+	// A config passed to Reload waits in pending until the sync loop
+	// swaps it in between syncs
+	pending  atomic.Pointer[config.Config]
+	reloadCh chan struct{}
+}
+
+// target is a sink with its privacy filters, one per source since a
+// source may tighten the sink's share level
+type target struct {
+	sink     sink.Sink
+	filters  map[string]*filter.Filter        // By source label
+	sharings map[string]*config.SharingConfig // By source label
+}
+
+// filter returns the privacy filter for items from the labelled source.
+// Items of unknown origin get the sink's own filter.
+func (t *target) filter(source string) *filter.Filter {
+	if f, ok := t.filters[source]; ok {
+		return f
+	}
+	return t.filters[""]
+}
+
+// sharing returns the sharing settings for items from the labelled source
+func (t *target) sharing(source string) *config.SharingConfig {
+	if s, ok := t.sharings[source]; ok {
+		return s
+	}
+	return t.sharings[""]
+}
+
+// transcriptRefs are the plan references of a transcript as of its
+// modification time
+type transcriptRefs struct {
+	modTime time.Time
+	refs    *parser.PlanRefs
+}
+
+// heldPlan records when a sink held back a plan of unknown project and
+// which transcripts had been scanned for links then
+type heldPlan struct {
+	at  time.Time
+	gen int
+}
+
+// sessionFile is a session log and the source it was found in
+type sessionFile struct {
+	path   string
+	source config.SourceConfig
 }
 
 // New creates a new Watcher
-func New(cfg *config.Config, logger *log.Logger) *Watcher {
-	return &Watcher{
+func New(cfg *config.Config, logger *slog.Logger) *Watcher {
+	w := &Watcher{
 		cfg:       cfg,
-		client:    client.New(cfg.Server.URL, cfg.Server.APIKey),
-		filter:    filter.New(&cfg.Sharing),
+		history:   history.New(config.PlanHistoryPath()),
 		statePath: config.StatePath(),
-		logsPath:  config.ClaudeLogsPath(),
+		sources:   cfg.ClaudeSources(),
 		logger:    logger,
+		metrics:   newWatcherMetrics(cfg.Metrics.Usage),
 		stopCh:    make(chan struct{}),
+		reloadCh:  make(chan struct{}, 1),
+		planRefs:  make(map[string]*transcriptRefs),
+		heldPlans: make(map[string]map[string]heldPlan),
 	}
+	w.targets = w.buildTargets(cfg, w.sources)
+	return w
+}
+
+// buildTargets creates the sinks of a config with their privacy filters
+func (w *Watcher) buildTargets(cfg *config.Config, sources []config.SourceConfig) []*target {
+	var targets []*target
+	for _, d := range cfg.Destinations() {
+		sinkLogger := w.logger.With("sink", d.Name)
+
+		s, err := sink.New(d, sink.Options{
+			Sync:    cfg.Sync,
+			Logger:  sinkLogger,
+			Stop:    w.stopCh,
+			OnError: w.metrics.errorHook(d.Name),
+
+			Interrupted: w.reloadPending,
+		})
+		if err != nil {
+			w.logger.Error("Skipping sink", "sink", d.Name, "error", err)
+			continue
+		}
+		t := &target{
+			sink:     s,
+			filters:  map[string]*filter.Filter{"": filter.New(d.Sharing)},
+			sharings: map[string]*config.SharingConfig{"": d.Sharing},
+		}
+		for _, src := range sources {
+			sharing := *d.Sharing
+			sharing.Level = config.StricterLevel(sharing.Level, src.ShareLevel)
+			t.filters[src.Label] = filter.New(&sharing)
+			t.sharings[src.Label] = &sharing
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// Reload replaces the config of a running watcher. It takes effect before
+// the next sync; a sync in progress stops after the batch being sent and
+// starts over under the new config, so nothing more is uploaded under the
+// old sharing settings. Logging and metrics settings only change on
+// restart.
+func (w *Watcher) Reload(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	w.pending.Store(cfg)
+	select {
+	case w.reloadCh <- struct{}{}:
+	default: // A reload is already signalled and will pick up cfg
+	}
+	return nil
+}
+
+// reloadPending reports whether a config passed to Reload waits to be
+// applied
+func (w *Watcher) reloadPending() bool {
+	return w.pending.Load() != nil
+}
+
+// applyReload swaps in a config passed to Reload, if any, and reports
+// whether it did
+func (w *Watcher) applyReload() bool {
+	cfg := w.pending.Swap(nil)
+	if cfg == nil {
+		return false
+	}
+
+	sources := cfg.ClaudeSources()
+	w.targets = w.buildTargets(cfg, sources)
+	w.sources = sources
+	w.cfg = cfg
+	w.heldPlans = make(map[string]map[string]heldPlan) // The new filters decide again
+
+	for _, d := range cfg.Destinations() {
+		w.logger.Info("Config reloaded", "sink", d.Name, "target", d.Target(), "share_level", d.Sharing.Level)
+	}
+	return true
+}
+
+// Metrics returns the registry holding the watcher's metrics
+func (w *Watcher) Metrics() *metrics.Registry {
+	return w.metrics.registry
 }
 
 // Start begins watching for new sessions
 func (w *Watcher) Start() error {
 	// Load state
 	if err := w.loadState(); err != nil {
-		w.logger.Printf("Warning: could not load state: %v", err)
-		w.state = &State{
-			SyncedSessions: make(map[string]time.Time),
-			SyncedPlans:    make(map[string]time.Time),
-		}
+		w.logger.Warn("Could not load state", "path", w.statePath, "error", err)
+		w.state = newState()
 	}
 
 	// Initial sync
-	w.logger.Println("Starting initial sync...")
+	w.logger.Info("Starting initial sync")
 	if err := w.sync(); err != nil {
-		w.logger.Printf("Initial sync error: %v", err)
+		w.logger.Error("Initial sync failed", "error", err)
 	}
 
 	// Start periodic sync
-	ticker := time.NewTicker(time.Duration(w.cfg.Sync.Interval) * time.Second)
+	interval := w.cfg.Sync.Interval
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()
 
-	w.logger.Printf("Watching %s (interval: %ds)", w.logsPath, w.cfg.Sync.Interval)
+	for _, src := range w.sources {
+		w.logger.Info("Watching for sessions", "source", src.Label, "path", src.Path, "interval_seconds", w.cfg.Sync.Interval)
+	}
 
 	for {
 		select {
 		case <-ticker.C:
 			if err := w.sync(); err != nil {
-				w.logger.Printf("Sync error: %v", err)
+				w.logger.Error("Sync failed", "error", err)
+			}
+		case <-w.reloadCh:
+			// The config may already have been swapped in by a sync
+			w.applyReload()
+			if w.cfg.Sync.Interval != interval {
+				interval = w.cfg.Sync.Interval
+				ticker.Reset(time.Duration(interval) * time.Second)
+				w.logger.Info("Sync interval changed", "interval_seconds", interval)
 			}
 		case <-w.stopCh:
-			w.logger.Println("Watcher stopped")
+			w.logger.Info("Watcher stopped")
 			return nil
 		}
 	}
@@ -90,188 +248,463 @@ func (w *Watcher) Stop() {
 // SyncOnce performs a single sync operation
 func (w *Watcher) SyncOnce() error {
 	if err := w.loadState(); err != nil {
-		w.state = &State{
-			SyncedSessions: make(map[string]time.Time),
-			SyncedPlans:    make(map[string]time.Time),
-		}
+		w.state = newState()
 	}
 	return w.sync()
 }
 
-// sync finds and uploads new sessions
-func (w *Watcher) sync() error {
-	// Find all JSONL session files
-	projectsDir := filepath.Join(w.logsPath, "projects")
-	files, err := w.findSessions(projectsDir)
+// sync finds new sessions and plan revisions and sends them to every
+// sink. A failing sink is reported but does not keep the others from
+// syncing. A config reloaded meanwhile interrupts the sinks between
+// batches, and the sync starts over under the new config.
+func (w *Watcher) sync() (err error) {
+	start := time.Now()
+	defer func() { w.metrics.observeSync(start, err) }()
+
+	for {
+		// A reload signalled while the loop was busy applies before uploading
+		w.applyReload()
+
+		err = w.syncTargets()
+		if !errors.Is(err, sink.ErrInterrupted) {
+			return err
+		}
+		w.logger.Info("Config changed during sync, starting over")
+	}
+}
+
+// syncTargets makes one pass over the sinks under the current config
+func (w *Watcher) syncTargets() error {
+	sessions, err := w.newSessions()
 	if err != nil {
 		return err
 	}
+	w.countUsage(sessions)
+	plans := w.pendingPlans()
+
+	var errs []error
+	for _, t := range w.targets {
+		if w.reloadPending() {
+			errs = append(errs, sink.ErrInterrupted)
+			break
+		}
+		name := t.sink.Name()
+		err := w.syncTarget(t, sessions, plans[name])
+		if errors.Is(err, sink.ErrInterrupted) {
+			errs = append(errs, err)
+			break
+		}
+		if err != nil {
+			w.logger.Error("Sink failed", "sink", name, "error", err)
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
+		w.metrics.observeSink(name, w.sinkState(name), sessions, plans[name], err)
+	}
+
+	w.state.LastSync = time.Now()
+	if err := w.saveState(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
 
-	// Filter to new sessions only
-	var newFiles []string
+// syncTarget filters sessions and plan revisions for a sink and sends
+// those it has not received yet
+func (w *Watcher) syncTarget(t *target, sessions []*parser.Session, plans []*parser.Plan) error {
+	st := w.sinkState(t.sink.Name())
+
+	var toSend []*parser.Session
+	for _, s := range sessions {
+		if st.SessionDone(s.ID) {
+			continue
+		}
+
+		// Apply privacy filter
+		filtered := t.filter(s.Source).Apply(s)
+		if filtered == nil {
+			w.logger.Debug("Session excluded by filter", "sink", t.sink.Name(), "session_id", s.ID, "project", s.ProjectName)
+			// Mark as synced anyway to avoid re-processing
+			st.MarkSession(s.ID)
+			continue
+		}
+		toSend = append(toSend, filtered)
+	}
+
+	// Plans wait for the next sync if sessions could not be sent, so an
+	// unreachable destination or a rejected API key is only reported once
+	if err := t.sink.SendSessions(toSend, st); err != nil {
+		return err
+	}
+
+	var filteredPlans []*parser.Plan
+	for _, plan := range plans {
+		f := t.filter(plan.Source)
+		filtered := f.ApplyPlan(plan)
+		if filtered == nil && f.HoldsPlan(plan) {
+			// Retried once a changed transcript may link it
+			w.logger.Debug("Plan held until linked to a session", "sink", t.sink.Name(), "plan", plan.Name, "revision", plan.Revision)
+			w.holdPlan(t.sink.Name(), plan.Key())
+			continue
+		}
+		if filtered == nil {
+			w.logger.Debug("Plan excluded by filter", "sink", t.sink.Name(), "plan", plan.Name, "revision", plan.Revision)
+			// Mark as synced anyway to avoid re-processing
+			st.MarkPlan(plan)
+			continue
+		}
+		filteredPlans = append(filteredPlans, filtered)
+	}
+
+	err := t.sink.SendPlans(filteredPlans, st)
+	st.SettlePlans(plans)
+	return err
+}
+
+// newSessions parses the session files at least one sink has not
+// received yet
+func (w *Watcher) newSessions() ([]*parser.Session, error) {
+	files, err := w.sessionFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter to sessions still pending for some sink, skipping those
+	// every sink synced or quarantined
+	var newFiles []sessionFile
 	for _, f := range files {
-		sessionID := filepath.Base(strings.TrimSuffix(f, ".jsonl"))
-		if _, synced := w.state.SyncedSessions[sessionID]; !synced {
-			newFiles = append(newFiles, f)
+		sessionID := filepath.Base(strings.TrimSuffix(f.path, ".jsonl"))
+		for _, t := range w.targets {
+			if !w.sinkState(t.sink.Name()).SessionDone(sessionID) {
+				newFiles = append(newFiles, f)
+				break
+			}
 		}
 	}
 
 	if len(newFiles) == 0 {
-		w.logger.Println("No new sessions to sync")
-	} else {
-		w.logger.Printf("Found %d new sessions", len(newFiles))
-
-		// Parse and upload sessions
-		var toUpload []*parser.Session
-		for _, f := range newFiles {
-			session, err := parser.ParseJSONL(f)
-			if err != nil {
-				w.logger.Printf("Error parsing %s: %v", f, err)
+		w.logger.Debug("No new sessions to sync")
+		return nil, nil
+	}
+	w.logger.Info("Found new sessions", "count", len(newFiles))
+
+	var sessions []*parser.Session
+	for _, f := range newFiles {
+		w.metrics.filesScanned.Inc("session")
+		session, err := w.parseSession(f)
+		if err != nil {
+			w.metrics.parseErrors.Inc("session")
+			w.logger.Error("Could not parse session", "source", f.source.Label, "path", f.path, "error", err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// sessionFiles finds the session logs of all sources
+func (w *Watcher) sessionFiles() ([]sessionFile, error) {
+	var files []sessionFile
+	for _, src := range w.sources {
+		paths, err := w.findSessions(filepath.Join(src.Path, "projects"))
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", src.Label, err)
+		}
+		for _, p := range paths {
+			files = append(files, sessionFile{path: p, source: src})
+		}
+	}
+	return files, nil
+}
+
+// countUsage adds new usage in local session files to the usage counters.
+// Every session file is checked, not only those a sink still needs, so
+// sessions that keep growing after their upload are counted too. Sessions
+// parsed for this sync are reused. Sessions no sink shares, because their
+// project is excluded or their source is at share level none, are not
+// counted, so the counters do not reveal their projects.
+func (w *Watcher) countUsage(parsed []*parser.Session) {
+	if !w.metrics.countsUsage() {
+		return
+	}
+	files, err := w.sessionFiles()
+	if err != nil {
+		w.logger.Error("Could not list sessions for usage metrics", "error", err)
+		return
+	}
+	byID := make(map[string]*parser.Session, len(parsed))
+	for _, s := range parsed {
+		byID[s.Source+"/"+s.ID] = s
+	}
+
+	for _, f := range files {
+		info, err := os.Stat(f.path)
+		if err != nil || !w.metrics.usageChanged(f.path, info.ModTime()) {
+			continue
+		}
+		id := filepath.Base(strings.TrimSuffix(f.path, ".jsonl"))
+		session := byID[f.source.Label+"/"+id]
+		if session == nil {
+			w.metrics.filesScanned.Inc("session")
+			if session, err = w.parseSession(f); err != nil {
+				w.metrics.parseErrors.Inc("session")
+				w.logger.Debug("Could not parse session for usage metrics", "path", f.path, "error", err)
 				continue
 			}
+		}
+		if !w.shared(session) {
+			w.metrics.ignoreUsage(f.path, info.ModTime())
+			continue
+		}
+		w.metrics.countUsage(f.path, info.ModTime(), session)
+	}
+}
+
+// shared reports whether the privacy filter of some sink lets a session
+// through
+func (w *Watcher) shared(s *parser.Session) bool {
+	for _, t := range w.targets {
+		if t.filter(s.Source).Apply(s) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSession parses a session log and tags it with its source
+func (w *Watcher) parseSession(f sessionFile) (*parser.Session, error) {
+	session, err := parser.ParseJSONLWithOptions(f.path, w.parseOptions(f.source))
+	if err != nil {
+		return nil, err
+	}
+	session.Source = f.source.Label
+	return session, nil
+}
+
+// parseOptions builds parser options from config for a source
+func (w *Watcher) parseOptions(src config.SourceConfig) parser.Options {
+	opts := parser.DefaultOptions()
+	opts.TodosDir = filepath.Join(src.Path, "todos")
+	if w.cfg.Parsing.IdleThreshold > 0 {
+		opts.IdleThreshold = time.Duration(w.cfg.Parsing.IdleThreshold) * time.Second
+	}
+	return opts
+}
+
+// pendingPlans records new and changed plans in the local history and
+// returns, per sink name, the revisions that sink has not received yet.
+// Sinks at share level none get nothing: plans stay pending until
+// sharing resumes.
+func (w *Watcher) pendingPlans() map[string][]*parser.Plan {
+	if len(w.heldPlans) > 0 {
+		w.refreshPlanRefs() // Held plans are retried once a transcript changes
+	}
+
+	pending := make(map[string][]*parser.Plan)
+	built := make(map[string]*parser.Plan) // Revisions shared between sinks, by name@revision
+	changed := 0
+	for _, src := range w.sources {
+		changed += w.sourcePlans(src, pending, built)
+	}
+
+	if changed == 0 {
+		return nil
+	}
+	w.logger.Info("Found new or updated plans", "count", changed)
 
-			// Apply privacy filter
-			filtered := w.filter.Apply(session)
-			if filtered == nil {
-				w.logger.Printf("Session %s excluded by filter", session.ID)
-				// Mark as synced anyway to avoid re-processing
-				w.state.SyncedSessions[session.ID] = time.Now()
+	// Link plans to the sessions that produced them
+	if len(built) > 0 {
+		all := make([]*parser.Plan, 0, len(built))
+		for _, p := range built {
+			all = append(all, p)
+		}
+		for _, path := range w.refreshPlanRefs() {
+			parser.LinkSession(all, path, w.planRefs[path].refs)
+		}
+	}
+
+	return pending
+}
+
+// refreshPlanRefs rescans the transcripts that changed since their plan
+// references were read and returns the paths of all scanned transcripts
+func (w *Watcher) refreshPlanRefs() []string {
+	files, err := w.sessionFiles()
+	if err != nil {
+		w.logger.Error("Could not list sessions for plans", "error", err)
+	}
+
+	seen := make(map[string]bool, len(files))
+	var paths []string
+	for _, f := range files {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			continue
+		}
+		seen[f.path] = true
+		if cached, ok := w.planRefs[f.path]; !ok || !cached.modTime.Equal(info.ModTime()) {
+			refs, err := parser.ScanPlanRefs(f.path)
+			if err != nil {
+				w.logger.Debug("Could not scan session for plans", "path", f.path, "error", err)
+				delete(w.planRefs, f.path)
 				continue
 			}
+			w.planRefs[f.path] = &transcriptRefs{modTime: info.ModTime(), refs: refs}
+			w.planRefsGen++
+		}
+		paths = append(paths, f.path)
+	}
 
-			toUpload = append(toUpload, filtered)
-		}
-
-		if len(toUpload) > 0 {
-			// Upload in batches of 10
-			batchSize := 10
-			for i := 0; i < len(toUpload); i += batchSize {
-				end := i + batchSize
-				if end > len(toUpload) {
-					end = len(toUpload)
-				}
-				batch := toUpload[i:end]
-
-				var uploadErr error
-				for attempt := 1; attempt <= w.cfg.Sync.RetryAttempts; attempt++ {
-					responses, err := w.client.UploadBatch(batch)
-					if err == nil {
-						for j, resp := range responses {
-							w.state.SyncedSessions[batch[j].ID] = time.Now()
-							if len(resp.Warnings) > 0 {
-								w.logger.Printf("Session %s: warnings: %v", resp.SessionID, resp.Warnings)
-							}
-						}
-						w.logger.Printf("Uploaded %d sessions", len(batch))
-						uploadErr = nil
-						break
-					}
-					uploadErr = err
-					w.logger.Printf("Upload attempt %d failed: %v", attempt, err)
-					time.Sleep(time.Duration(attempt*2) * time.Second)
-				}
-
-				if uploadErr != nil {
-					w.logger.Printf("Failed to upload batch after %d attempts", w.cfg.Sync.RetryAttempts)
-				}
-			}
+	for path := range w.planRefs {
+		if !seen[path] {
+			delete(w.planRefs, path)
 		}
 	}
+	return paths
+}
 
-	// Sync plans
-	if err := w.syncPlans(); err != nil {
-		w.logger.Printf("Plan sync error: %v", err)
+// holdPlan records that a sink held back a plan until it is linked
+func (w *Watcher) holdPlan(sinkName, key string) {
+	held := w.heldPlans[sinkName]
+	if held == nil {
+		held = make(map[string]heldPlan)
+		w.heldPlans[sinkName] = held
 	}
+	held[key] = heldPlan{at: time.Now(), gen: w.planRefsGen}
+}
 
-	w.state.LastSync = time.Now()
-	return w.saveState()
+// planNeeded reports whether a sink needs a plan modified at modTime: it
+// changed since the sink last synced it and, if the sink held it back,
+// since then or a transcript changed
+func (w *Watcher) planNeeded(sinkName, key string, modTime time.Time) bool {
+	if !w.sinkState(sinkName).PlanChanged(key, modTime) {
+		delete(w.heldPlans[sinkName], key)
+		return false
+	}
+	h, ok := w.heldPlans[sinkName][key]
+	return !ok || h.gen != w.planRefsGen || modTime.After(h.at)
 }
 
-// syncPlans finds and uploads new plans
-func (w *Watcher) syncPlans() error {
-	plansDir := filepath.Join(w.logsPath, "plans")
+// sourcePlans records the changed plans of one source, adds the revisions
+// each sink still needs to pending and returns how many plans changed
+func (w *Watcher) sourcePlans(src config.SourceConfig, pending map[string][]*parser.Plan, built map[string]*parser.Plan) int {
+	plansDir := filepath.Join(src.Path, "plans")
 
 	// Check if plans directory exists
 	if _, err := os.Stat(plansDir); os.IsNotExist(err) {
-		return nil // No plans directory, nothing to sync
+		return 0 // No plans directory, nothing to sync
 	}
 
 	files, err := w.findPlans(plansDir)
 	if err != nil {
-		return err
+		w.logger.Error("Could not list plans", "source", src.Label, "error", err)
+		return 0
+	}
+
+	var active []*target
+	for _, t := range w.targets {
+		if t.sharing(src.Label).Level != "none" {
+			active = append(active, t)
+		}
 	}
 
-	// Filter to new/updated plans
-	var newFiles []string
+	changed := 0
 	for _, f := range files {
-		name := filepath.Base(strings.TrimSuffix(f, ".md"))
+		key := parser.PlanKey(src.Label, filepath.Base(strings.TrimSuffix(f, ".md")))
 		info, err := os.Stat(f)
 		if err != nil {
 			continue
 		}
 
-		// Check if plan is new or modified since last sync
-		lastSynced, synced := w.state.SyncedPlans[name]
-		if !synced || info.ModTime().After(lastSynced) {
-			newFiles = append(newFiles, f)
+		// Check if plan is new or modified since some sink last synced it
+		var needed []*target
+		for _, t := range active {
+			if w.planNeeded(t.sink.Name(), key, info.ModTime()) {
+				needed = append(needed, t)
+			}
 		}
-	}
-
-	if len(newFiles) == 0 {
-		return nil
-	}
-
-	w.logger.Printf("Found %d new/updated plans", len(newFiles))
+		if len(needed) == 0 {
+			continue
+		}
+		changed++
 
-	// Parse and upload plans
-	var toUpload []*parser.Plan
-	for _, f := range newFiles {
+		w.metrics.filesScanned.Inc("plan")
 		plan, err := parser.ParsePlan(f)
 		if err != nil {
-			w.logger.Printf("Error parsing plan %s: %v", f, err)
+			w.metrics.parseErrors.Inc("plan")
+			w.logger.Error("Could not parse plan", "source", src.Label, "path", f, "error", err)
+			continue
+		}
+		plan.Source = src.Label
+		if _, _, err := w.history.Record(plan.Key(), []byte(plan.Content), plan.CreatedAt); err != nil {
+			w.logger.Error("Could not record plan history", "plan", plan.Name, "error", err)
 			continue
 		}
-		toUpload = append(toUpload, plan)
+
+		for _, t := range needed {
+			st := w.sinkState(t.sink.Name())
+			revisions, err := w.planRevisions(plan, st.PlanRevisions[plan.Key()], built)
+			if err != nil {
+				w.logger.Error("Could not read plan history", "plan", plan.Name, "error", err)
+				continue
+			}
+			// Skip revisions delivered past one that failed
+			revisions = slices.DeleteFunc(revisions, st.PlanDone)
+			if len(revisions) == 0 {
+				// Touched but unchanged since the last synced revision
+				st.TouchPlan(plan.Key())
+				continue
+			}
+			pending[t.sink.Name()] = append(pending[t.sink.Name()], revisions...)
+		}
 	}
+	return changed
+}
 
-	if len(toUpload) == 0 {
-		return nil
+// planRevisions returns one plan per revision newer than after, each with
+// a diff from its parent. Revisions already built for another sink are
+// taken from built.
+func (w *Watcher) planRevisions(plan *parser.Plan, after int, built map[string]*parser.Plan) ([]*parser.Plan, error) {
+	pending, err := w.history.Since(plan.Key(), after)
+	if err != nil {
+		return nil, err
 	}
 
-	// Upload in batches of 10
-	batchSize := 10
-	for i := 0; i < len(toUpload); i += batchSize {
-		end := i + batchSize
-		if end > len(toUpload) {
-			end = len(toUpload)
-		}
-		batch := toUpload[i:end]
-
-		var uploadErr error
-		for attempt := 1; attempt <= w.cfg.Sync.RetryAttempts; attempt++ {
-			responses, err := w.client.UploadPlanBatch(batch)
-			if err == nil {
-				for j, resp := range responses {
-					w.state.SyncedPlans[batch[j].Name] = time.Now()
-					if len(resp.Warnings) > 0 {
-						w.logger.Printf("Plan %s: warnings: %v", resp.Name, resp.Warnings)
-					}
-				}
-				w.logger.Printf("Uploaded %d plans", len(batch))
-				uploadErr = nil
-				break
+	var revisions []*parser.Plan
+	for i, rev := range pending {
+		key := fmt.Sprintf("%s@%d", plan.Key(), rev.Number)
+		if revPlan, ok := built[key]; ok {
+			revisions = append(revisions, revPlan)
+			continue
+		}
+
+		// The latest revision is the content just parsed, older ones are re-read
+		revPlan := plan
+		if i < len(pending)-1 {
+			content, err := w.history.Content(rev.Hash)
+			if err != nil {
+				return nil, err
 			}
-			uploadErr = err
-			w.logger.Printf("Plan upload attempt %d failed: %v", attempt, err)
-			time.Sleep(time.Duration(attempt*2) * time.Second)
+			revPlan = parser.ParsePlanContent(plan.Name, content, rev.CreatedAt)
+			revPlan.Source = plan.Source
 		}
 
-		if uploadErr != nil {
-			w.logger.Printf("Failed to upload plan batch after %d attempts", w.cfg.Sync.RetryAttempts)
+		parent, err := w.history.Content(rev.Parent)
+		if err != nil {
+			return nil, err
 		}
+
+		revPlan.Revision = rev.Number
+		revPlan.ContentHash = rev.Hash
+		revPlan.Diff, revPlan.LinesAdded, revPlan.LinesRemoved = history.Diff(
+			fmt.Sprintf("%s.md (revision %d)", plan.Name, rev.Number-1),
+			fmt.Sprintf("%s.md (revision %d)", plan.Name, rev.Number),
+			string(parent), revPlan.Content,
+		)
+		built[key] = revPlan
+		revisions = append(revisions, revPlan)
 	}
 
-	return nil
+	return revisions, nil
 }
 
 // findPlans finds all markdown plan files in the plans directory
@@ -308,25 +741,70 @@ func (w *Watcher) findSessions(dir string) ([]string, error) {
 	return files, err
 }
 
+// newState creates an empty state
+func newState() *State {
+	return &State{Sinks: make(map[string]*sink.State)}
+}
+
+// sinkState returns the state of the named sink, creating it if needed
+func (w *Watcher) sinkState(name string) *sink.State {
+	st := w.state.Sinks[name]
+	if st == nil {
+		st = sink.NewState()
+		w.state.Sinks[name] = st
+	}
+	return st
+}
+
 // loadState loads sync state from disk
 func (w *Watcher) loadState() error {
+	w.state = newState()
+
 	data, err := os.ReadFile(w.statePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			w.state = &State{
-				SyncedSessions: make(map[string]time.Time),
-				SyncedPlans:    make(map[string]time.Time),
-			}
 			return nil
 		}
 		return err
 	}
 
-	w.state = &State{
-		SyncedSessions: make(map[string]time.Time),
-		SyncedPlans:    make(map[string]time.Time),
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+	w.state = state
+	if w.state.Sinks == nil {
+		w.state.Sinks = make(map[string]*sink.State)
+		if err := w.migrateState(data); err != nil {
+			return err
+		}
+	}
+	for _, st := range w.state.Sinks {
+		st.Init()
+	}
+	return nil
+}
+
+// migrateState moves the single-destination state written by older
+// agents to the default sink. Their last synced plan revisions were kept
+// in the plan history.
+func (w *Watcher) migrateState(data []byte) error {
+	legacy := &sink.State{}
+	if err := json.Unmarshal(data, legacy); err != nil {
+		return err
+	}
+	if len(legacy.SyncedSessions) == 0 && len(legacy.SyncedPlans) == 0 {
+		return nil
+	}
+
+	legacy.Init()
+	for name := range legacy.SyncedPlans {
+		if rev, err := w.history.LegacySynced(name); err == nil && rev > 0 {
+			legacy.PlanRevisions[name] = rev
+		}
 	}
-	return json.Unmarshal(data, w.state)
+	w.state.Sinks[config.DefaultSinkName] = legacy
+	return nil
 }
 
 // saveState persists sync state to disk
@@ -351,16 +829,29 @@ func (w *Watcher) GetStats() Stats {
 		return Stats{}
 	}
 
-	return Stats{
-		TotalSynced:      len(w.state.SyncedSessions),
-		TotalPlansSynced: len(w.state.SyncedPlans),
-		LastSync:         w.state.LastSync,
+	stats := Stats{LastSync: w.state.LastSync}
+	for _, t := range w.targets {
+		st := w.sinkState(t.sink.Name())
+		stats.Sinks = append(stats.Sinks, SinkStats{
+			Name:             t.sink.Name(),
+			TotalSynced:      len(st.SyncedSessions),
+			TotalPlansSynced: len(st.SyncedPlans),
+			Quarantined:      len(st.Quarantined) + len(st.QuarantinedPlans),
+		})
 	}
+	return stats
 }
 
 // Stats contains watcher statistics
 type Stats struct {
-	TotalSynced      int       `json:"total_synced"`
-	TotalPlansSynced int       `json:"total_plans_synced"`
-	LastSync         time.Time `json:"last_sync"`
+	Sinks    []SinkStats `json:"sinks"`
+	LastSync time.Time   `json:"last_sync"`
+}
+
+// SinkStats contains the statistics of a single sink
+type SinkStats struct {
+	Name             string `json:"name"`
+	TotalSynced      int    `json:"total_synced"`
+	TotalPlansSynced int    `json:"total_plans_synced"`
+	Quarantined      int    `json:"quarantined"`
 }
@@ -0,0 +1,373 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dkd/claude-insights-agent/internal/config"
+	"github.com/dkd/claude-insights-agent/internal/filter"
+	"github.com/dkd/claude-insights-agent/internal/parser"
+	"github.com/dkd/claude-insights-agent/internal/sink"
+)
+
+// reloadingSink stands in for a sink whose config changes while it sends:
+// it calls reload once, then stops between batches like the real sinks
+type reloadingSink struct {
+	reload func()
+	sent   int
+}
+
+func (s *reloadingSink) Name() string { return "out" }
+
+func (s *reloadingSink) SendSessions(sessions []*parser.Session, st *sink.State) error {
+	if s.reload != nil {
+		s.reload()
+		s.reload = nil
+		return sink.ErrInterrupted
+	}
+	s.sent += len(sessions)
+	for _, session := range sessions {
+		st.MarkSession(session.ID)
+	}
+	return nil
+}
+
+func (s *reloadingSink) SendPlans(plans []*parser.Plan, st *sink.State) error {
+	return nil
+}
+
+// testConfig returns a config reading sessions from source and writing
+// them to a directory sink at out
+func testConfig(source, out string, exclude ...string) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Sources = []config.SourceConfig{{Label: "test", Path: source}}
+	cfg.Sinks = []config.SinkConfig{{
+		Name:    "out",
+		Type:    config.SinkDirectory,
+		Path:    out,
+		Sharing: &config.SharingConfig{Level: "metadata", ExcludeProjects: exclude},
+	}}
+	return cfg
+}
+
+func TestSyncRestartsOnReload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // Holds the state and plan history
+
+	source := t.TempDir()
+	for _, project := range []string{"app", "secret"} {
+		dir := filepath.Join(source, "projects", "-home-u-"+project)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		line := `{"type":"user","timestamp":"2026-01-01T10:00:00Z","cwd":"/home/u/` + project + `","message":{"content":"hi"}}` + "\n"
+		if err := os.WriteFile(filepath.Join(dir, project+".jsonl"), []byte(line), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		reload    bool
+		wantFiles []string // Sessions written by the directory sink of the new config
+		wantSent  int      // Sessions sent by the original sink
+	}{
+		{"no reload", false, nil, 2},
+		{"reload mid-sync", true, []string{"app.json"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.RemoveAll(filepath.Join(os.Getenv("HOME"), ".local"))
+			out := t.TempDir()
+			w := New(testConfig(source, t.TempDir()), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			original := &reloadingSink{}
+			if tt.reload {
+				original.reload = func() {
+					if err := w.Reload(testConfig(source, out, "**/secret")); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			w.targets = []*target{{
+				sink:    original,
+				filters: map[string]*filter.Filter{"": filter.New(&config.SharingConfig{Level: "metadata"})},
+			}}
+
+			if err := w.SyncOnce(); err != nil {
+				t.Fatal(err)
+			}
+			if original.sent != tt.wantSent {
+				t.Errorf("original sink sent %d, want %d", original.sent, tt.wantSent)
+			}
+			var got []string
+			entries, _ := os.ReadDir(filepath.Join(out, "sessions"))
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if len(got) != len(tt.wantFiles) || (len(got) > 0 && got[0] != tt.wantFiles[0]) {
+				t.Errorf("new sink wrote %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestHeldPlanWaitsForTranscripts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	source := t.TempDir()
+	project := filepath.Join(source, "projects", "-home-u-app")
+	for _, dir := range []string{project, filepath.Join(source, "plans")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transcript := filepath.Join(project, "s1.jsonl")
+	line := `{"type":"user","timestamp":"2026-01-01T10:00:00Z","cwd":"/home/u/app","message":{"content":"hi"}}` + "\n"
+	if err := os.WriteFile(transcript, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "plans", "p.md"), []byte("# Plan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	w := New(testConfig(source, out, "**/secret"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	const scanned = `claude_insights_files_scanned_total{kind="plan"}`
+	sent := filepath.Join(out, "plans", "test", "p", "1.json")
+
+	// Unlinked, the plan is held and not parsed again while no transcript
+	// changes
+	for i := 0; i < 2; i++ {
+		if err := w.SyncOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := metricLine(t, w.metrics, scanned); got != scanned+" 1" {
+		t.Errorf("after two syncs %q, want 1 plan parsed", got)
+	}
+	if _, err := os.Stat(sent); !os.IsNotExist(err) {
+		t.Fatalf("held plan was written: %v", err)
+	}
+
+	// A transcript mentioning the plan file links it to a project
+	line = `{"type":"assistant","timestamp":"2026-01-01T10:01:00Z","cwd":"/home/u/app","message":{"content":"see ~/.claude/plans/p.md"}}` + "\n"
+	f, err := os.OpenFile(transcript, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(line)
+	f.Close()
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(transcript, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.SyncOnce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := metricLine(t, w.metrics, scanned); got != scanned+" 2" {
+		t.Errorf("after the transcript changed %q, want 2 plans parsed", got)
+	}
+	if _, err := os.Stat(sent); err != nil {
+		t.Errorf("linked plan not written: %v", err)
+	}
+}
+
+// writeSession writes a one-message session log for a project under
+// source
+func writeSession(t *testing.T, source, project, id, content string) {
+	t.Helper()
+	dir := filepath.Join(source, "projects", "-home-u-"+project)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	line := `{"type":"user","timestamp":"2026-01-01T10:00:00Z","cwd":"/home/u/` + project + `","message":{"content":"` + content + `"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, id+".jsonl"), []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingSink rejects every delivery
+type failingSink struct{}
+
+func (failingSink) Name() string { return "broken" }
+
+func (failingSink) SendSessions(sessions []*parser.Session, st *sink.State) error {
+	return errors.New("destination down")
+}
+
+func (failingSink) SendPlans(plans []*parser.Plan, st *sink.State) error {
+	return errors.New("destination down")
+}
+
+func TestFailingSinkDoesNotBlockOthers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	source := t.TempDir()
+	writeSession(t, source, "app", "s1", "hi")
+
+	out := t.TempDir()
+	w := New(testConfig(source, out), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	sharing := &config.SharingConfig{Level: "metadata"}
+	broken := &target{
+		sink:     failingSink{},
+		filters:  map[string]*filter.Filter{"": filter.New(sharing)},
+		sharings: map[string]*config.SharingConfig{"": sharing},
+	}
+	w.targets = append([]*target{broken}, w.targets...)
+
+	err := w.SyncOnce()
+	if err == nil || !strings.Contains(err.Error(), "sink broken") {
+		t.Errorf("err = %v, want the broken sink reported", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "sessions", "s1.json")); err != nil {
+		t.Errorf("working sink did not receive the session: %v", err)
+	}
+	if !w.sinkState("out").SessionDone("s1") {
+		t.Error("session not recorded for the working sink")
+	}
+	if w.sinkState("broken").SessionDone("s1") {
+		t.Error("session recorded for the broken sink")
+	}
+}
+
+func TestPerSinkShareLevel(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	source := t.TempDir()
+	writeSession(t, source, "app", "s1", "the message text")
+
+	cfg := testConfig(source, t.TempDir())
+	outs := make(map[string]string)
+	cfg.Sinks = nil
+	for _, level := range []string{"none", "metadata", "full"} {
+		outs[level] = t.TempDir()
+		cfg.Sinks = append(cfg.Sinks, config.SinkConfig{
+			Name:    level,
+			Type:    config.SinkDirectory,
+			Path:    outs[level],
+			Sharing: &config.SharingConfig{Level: level},
+		})
+	}
+	w := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := w.SyncOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		level       string
+		wantSession bool
+		wantContent bool
+	}{
+		{"none", false, false},
+		{"metadata", true, false},
+		{"full", true, true},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(outs[tt.level], "sessions", "s1.json"))
+		if (err == nil) != tt.wantSession {
+			t.Errorf("%s: session written = %v, want %v", tt.level, err == nil, tt.wantSession)
+			continue
+		}
+		if hasContent := strings.Contains(string(data), "the message text"); hasContent != tt.wantContent {
+			t.Errorf("%s: message content shared = %v, want %v", tt.level, hasContent, tt.wantContent)
+		}
+	}
+}
+
+func TestMigrateLegacyState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	w := New(testConfig(t.TempDir(), t.TempDir()), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Older agents kept one state for the server and flagged synced plan
+	// revisions in the plan history
+	files := map[string]string{
+		w.statePath: `{"synced_sessions":{"s1":"2026-01-01T10:00:00Z"},"synced_plans":{"p":"2026-01-01T10:00:00Z"},"last_sync":"2026-01-01T10:00:00Z"}`,
+		filepath.Join(config.PlanHistoryPath(), "plans", "p.json"): `{"revisions":[{"revision":1,"hash":"a","synced":true},{"revision":2,"hash":"b","synced":true},{"revision":3,"hash":"c"}]}`,
+	}
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.state.Sinks) != 1 {
+		t.Fatalf("sinks = %v, want only %s", w.state.Sinks, config.DefaultSinkName)
+	}
+	st := w.state.Sinks[config.DefaultSinkName]
+	if st == nil {
+		t.Fatalf("legacy state not moved to the %s sink", config.DefaultSinkName)
+	}
+	if !st.SessionDone("s1") {
+		t.Error("legacy synced session lost")
+	}
+	if got := st.PlanRevisions["p"]; got != 2 {
+		t.Errorf("plan synced up to revision %d, want 2", got)
+	}
+	if st.Uploads == nil || st.QuarantinedPlans == nil {
+		t.Error("migrated state not initialized")
+	}
+}
+
+func TestSourceShareLevel(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	sources := []config.SourceConfig{
+		{Label: "work", Path: t.TempDir()},
+		{Label: "personal", Path: t.TempDir(), ShareLevel: "none"},
+		{Label: "container", Path: t.TempDir(), ShareLevel: "metadata"},
+	}
+	for _, src := range sources {
+		writeSession(t, src.Path, "app", src.Label, "the message text")
+	}
+
+	out := t.TempDir()
+	cfg := testConfig(sources[0].Path, out)
+	cfg.Sources = sources
+	cfg.Sinks[0].Sharing.Level = "full"
+	w := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := w.SyncOnce(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source      string
+		wantSession bool
+		wantContent bool
+	}{
+		{"work", true, true},
+		{"personal", false, false},
+		{"container", true, false},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(out, "sessions", tt.source+".json"))
+		if (err == nil) != tt.wantSession {
+			t.Errorf("%s: session written = %v, want %v", tt.source, err == nil, tt.wantSession)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var session parser.Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			t.Fatal(err)
+		}
+		if session.Source != tt.source {
+			t.Errorf("%s: session source = %q", tt.source, session.Source)
+		}
+		if hasContent := strings.Contains(string(data), "the message text"); hasContent != tt.wantContent {
+			t.Errorf("%s: message content shared = %v, want %v", tt.source, hasContent, tt.wantContent)
+		}
+	}
+}